@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseBandwidth parses rate like 500KB/s or 2MB/s to bytes per second, '/s' is optional,
+// empty string or 0 means no limit
+func parseBandwidth(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	rate, err := parseSize(strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "/S"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth '%s', use e.g. 500KB/s or 2MB/s", s)
+	}
+	return rate, nil
+}
+
+// bandwidthPeriod is time of day range with own rate, minutes since midnight,
+// range wraps midnight if from > to
+type bandwidthPeriod struct {
+	from, to int
+	rate     int64 // bytes per second, 0 means no limit
+}
+
+func (p bandwidthPeriod) contains(minute int) bool {
+	if p.from < p.to {
+		return minute >= p.from && minute < p.to
+	}
+	return minute >= p.from || minute < p.to
+}
+
+// parseBandwidthSchedule parses 'bandwidth-schedule' setting:
+// comma separated list of HH:MM-HH:MM=rate, e.g. '01:00-06:00=0, 18:00-23:00=1MB/s'
+func parseBandwidthSchedule(s string) ([]bandwidthPeriod, error) {
+	periods := []bandwidthPeriod{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.SplitN(part, "=", 2)
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(fields) != 2 || len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid bandwidth period '%s', use e.g. 01:00-06:00=0 or 18:00-23:00=1MB/s", part)
+		}
+		from, err := parseTimeOfDay(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		to, err := parseTimeOfDay(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		if from == to {
+			return nil, fmt.Errorf("bandwidth period '%s' is empty", part)
+		}
+		rate, err := parseBandwidth(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		periods = append(periods, bandwidthPeriod{from: from, to: to, rate: rate})
+	}
+	return periods, nil
+}
+
+// parseTimeOfDay parses HH:MM to minutes since midnight
+func parseTimeOfDay(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s', use HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// bandwidthLimit is 'max-bandwidth' setting changed by 'bandwidth-schedule' periods
+type bandwidthLimit struct {
+	Max      int64
+	Schedule []bandwidthPeriod
+}
+
+// parseBandwidthLimit parses 'max-bandwidth' and 'bandwidth-schedule' settings
+func parseBandwidthLimit(maxBandwidth, schedule string) (bandwidthLimit, error) {
+	var limit bandwidthLimit
+	var err error
+	if limit.Max, err = parseBandwidth(maxBandwidth); err != nil {
+		return limit, fmt.Errorf("max-bandwidth: %v", err)
+	}
+	if limit.Schedule, err = parseBandwidthSchedule(schedule); err != nil {
+		return limit, fmt.Errorf("bandwidth-schedule: %v", err)
+	}
+	return limit, nil
+}
+
+// rate returns bytes per second allowed at time t, first matching period wins, 0 means no limit
+func (l bandwidthLimit) rate(t time.Time) int64 {
+	minute := t.Hour()*60 + t.Minute()
+	for _, p := range l.Schedule {
+		if p.contains(minute) {
+			return p.rate
+		}
+	}
+	return l.Max
+}
+
+func (l bandwidthLimit) isSet() bool {
+	return l.Max > 0 || len(l.Schedule) > 0
+}
+
+// bandwidthLimiter is shared by all transfers limited together,
+// rate is checked for each read, so schedule is applied to running transfers
+type bandwidthLimiter struct {
+	limit bandwidthLimit
+	now   func() time.Time
+
+	mu   sync.Mutex
+	next time.Time // bytes read before are sent at the rate by this time
+}
+
+func newBandwidthLimiter(limit bandwidthLimit) *bandwidthLimiter {
+	return &bandwidthLimiter{limit: limit, now: time.Now}
+}
+
+// reserve accounts n read bytes, returns delay before next read
+func (l *bandwidthLimiter) reserve(n int) time.Duration {
+	now := l.now()
+	rate := l.limit.rate(now)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// idle time is not saved for later bursts
+	if l.next.Before(now) {
+		l.next = now
+	}
+	if rate <= 0 {
+		return 0
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / rate))
+	return l.next.Sub(now)
+}
+
+// maxReadSize keeps read bursts short for low rates
+const maxReadSize = 16 * 1024
+
+// throttledBody limits reading of response body by all limiters
+type throttledBody struct {
+	io.ReadCloser
+	limiters []*bandwidthLimiter
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > maxReadSize {
+		p = p[:maxReadSize]
+	}
+	n, err := b.ReadCloser.Read(p)
+	var delay time.Duration
+	for _, l := range b.limiters {
+		if d := l.reserve(n); d > delay {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return n, err
+}
+
+// throttledTransport limits bandwidth of response bodies
+type throttledTransport struct {
+	base     http.RoundTripper
+	limiters []*bandwidthLimiter
+}
+
+// newThrottledTransport returns base transport, if no limiter is set
+func newThrottledTransport(base http.RoundTripper, limiters ...*bandwidthLimiter) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	used := []*bandwidthLimiter{}
+	for _, l := range limiters {
+		if l != nil {
+			used = append(used, l)
+		}
+	}
+	if len(used) == 0 {
+		return base
+	}
+	return &throttledTransport{base: base, limiters: used}
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &throttledBody{ReadCloser: resp.Body, limiters: t.limiters}
+	return resp, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	cases := map[string]int64{
+		"":        0,
+		"0":       0,
+		"2MB/s":   2 << 20,
+		"500KB/s": 500 << 10,
+		"500k":    500 << 10,
+		"1.5M/s":  3 << 19,
+	}
+	for s, rate := range cases {
+		r, err := parseBandwidth(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, rate, r, s)
+		}
+	}
+	for _, s := range []string{"fast", "2MB/h", "-1K"} {
+		_, err := parseBandwidth(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestBandwidthSchedule(t *testing.T) {
+	limit, err := parseBandwidthLimit("500KB/s", "01:00-06:00=0, 22:00-00:30=1MB/s")
+	if !assert.NoError(t, err) {
+		return
+	}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2016, 8, 11, hour, minute, 0, 0, time.Local)
+	}
+	assert.Equal(t, int64(0), limit.rate(at(1, 0)))
+	assert.Equal(t, int64(0), limit.rate(at(5, 59)))
+	assert.Equal(t, int64(500<<10), limit.rate(at(6, 0)))
+	assert.Equal(t, int64(1<<20), limit.rate(at(23, 0)))
+	assert.Equal(t, int64(1<<20), limit.rate(at(0, 15)))
+	assert.Equal(t, int64(500<<10), limit.rate(at(0, 30)))
+
+	for _, s := range []string{"01:00-06:00", "1-6=0", "01:00=0", "25:00-06:00=0", "06:00-06:00=0", "01:00-06:00=fast"} {
+		_, err := parseBandwidthSchedule(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	now := time.Date(2016, 8, 11, 12, 0, 0, 0, time.Local)
+	l := newBandwidthLimiter(bandwidthLimit{Max: 1000, Schedule: []bandwidthPeriod{{from: 13 * 60, to: 14 * 60}}})
+	l.now = func() time.Time { return now }
+
+	assert.Equal(t, time.Second, l.reserve(1000))
+	assert.Equal(t, 1500*time.Millisecond, l.reserve(500), "reads are limited together")
+
+	// schedule is applied during transfer
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), l.reserve(1000000))
+
+	// idle time is not saved
+	now = now.Add(time.Hour)
+	assert.Equal(t, 100*time.Millisecond, l.reserve(100))
+}
+
+func TestThrottledTransport(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 20*1024)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	assert.Equal(t, http.DefaultTransport, newThrottledTransport(nil, nil, nil), "no limit")
+
+	limiter := newBandwidthLimiter(bandwidthLimit{Max: 40 * 1024})
+	client := &http.Client{Transport: newThrottledTransport(nil, limiter)}
+	started := time.Now()
+	resp, err := client.Get(ts.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, data, body)
+	assert.True(t, time.Since(started) >= 400*time.Millisecond, "20KB at 40KB/s should take 0.5s, took %s", time.Since(started))
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"strconv"
 	"time"
 
@@ -57,6 +58,12 @@ func cmdList() cli.Command {
 			log.Warn("No podcasts added yet")
 			return nil
 		}
+		if !output.IsText() {
+			for _, podcast := range cfg.GetAllPodcasts() {
+				output.Emit(podcast)
+			}
+			return nil
+		}
 		for n, podcast := range cfg.GetAllPodcasts() {
 			var lastUpdated string
 			isDisabledStr := ""
@@ -96,7 +103,7 @@ func cmdAdd() cli.Command {
 
 		if podcastName == "" {
 			var err error
-			podcastName, err = getRssName(url)
+			podcastName, err = getFeedName(url)
 			if err != nil {
 				log.Fatal("Failed to get podacast name from url: %s, Error: %s", url, err.Error())
 				return cli.NewExitError("", 1)
@@ -118,6 +125,83 @@ func cmdAdd() cli.Command {
 	return cmd
 }
 
+// 'import' - command
+func cmdImport() cli.Command {
+	cmd := cli.Command{}
+	cmd.Name = "import"
+	cmd.Usage = "import podcasts from OPML file"
+	cmd.ArgsUsage = "<file.opml>"
+	cmd.Action = func(c *cli.Context) error {
+		if !checkArgumentsCount(c, "import", 1) {
+			return cli.NewExitError("", 1)
+		}
+
+		fs, err := os.Open(expandPath(c.Args().First()))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer fs.Close()
+
+		podcasts, err := readOPML(fs)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		added := 0
+		for _, p := range podcasts {
+			if p.Name == "" {
+				if p.Name, err = getFeedName(p.Url); err != nil {
+					log.Warnf("Failed to get podacast name from url: %s, Error: %s", p.Url, err.Error())
+					continue
+				}
+			}
+			if err := cfg.AddPodcastWithSettings(p.Name, p.Url, p.Settings); err != nil {
+				if err == ErrPodacastAlreadyExist {
+					log.Warnf("Podcast <%s> exists already, skipped", p.Name)
+					continue
+				}
+				return cli.NewExitError(err.Error(), 1)
+			}
+			added++
+			log.Printf("* Podcast [%s] added", p.Name)
+		}
+		log.Infof("%d of %d podcasts imported", added, len(podcasts))
+		return nil
+	}
+
+	return cmd
+}
+
+// 'export' - command
+func cmdExport() cli.Command {
+	cmd := cli.Command{}
+	cmd.Name = "export"
+	cmd.Usage = "export podcasts to OPML file, stdout is used if file is omitted"
+	cmd.ArgsUsage = "[file]"
+	cmd.Action = func(c *cli.Context) error {
+		if c.Args().First() == "" {
+			if err := writeOPML(os.Stdout, cfg); err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			return nil
+		}
+
+		fs, err := os.Create(expandPath(c.Args().First()))
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		defer fs.Close()
+
+		if err := writeOPML(fs, cfg); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		log.Printf("* %d podcasts exported to %s", cfg.PodcastLen(), fs.Name())
+		return nil
+	}
+
+	return cmd
+}
+
 // 'remove' - command
 func cmdRemove() cli.Command {
 	cmd := cli.Command{}
@@ -196,10 +280,125 @@ func cmdCheck() cli.Command {
 
 		podcastCount := c.Int("count")
 		nameOrID := c.String("name")
-		if err = syncPodcasts(date, nameOrID, podcastCount, true); err != nil {
+		if err = syncPodcasts(date, nameOrID, podcastCount, true, false); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		return nil
+	}
+
+	return cmd
+}
+
+// 'prune' - command
+func cmdPrune() cli.Command {
+	cmd := cli.Command{}
+	cmd.Name = "prune"
+	cmd.Usage = "remove downloaded files according to keep-count, keep-days and keep-size settings"
+	cmd.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only list files, which would be removed",
+		},
+		cli.StringFlag{
+			Name:  "name, n",
+			Value: "",
+			Usage: "Name or Id of podacast to prune",
+		},
+	}
+	cmd.Action = func(c *cli.Context) error {
+		podcasts := cfg.GetAllPodcasts()
+		if nameOrID := c.String("name"); nameOrID != "" {
+			p, err := cfg.GetPodcastByNameOrID(nameOrID)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			podcasts = []*Podcast{p}
+		}
+		if err := prunePodcasts(podcasts, c.Bool("dry-run")); err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
+		return nil
+	}
+
+	return cmd
+}
 
+// 'feed' - command
+func cmdFeed() cli.Command {
+	cmd := cli.Command{}
+	cmd.Name = "feed"
+	cmd.Usage = "write RSS feeds of downloaded files, enclosure urls are built from public-base-url"
+	cmd.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "name, n",
+			Value: "",
+			Usage: "Name or Id of podacast",
+		},
+		cli.StringFlag{
+			Name:  "dir",
+			Usage: "Directory for feed files, download-path of podcast by default",
+		},
+		cli.StringFlag{
+			Name:  "merged, m",
+			Usage: "Write merged feed of all podcasts to file",
+		},
+	}
+	cmd.Action = func(c *cli.Context) error {
+		podcasts := cfg.GetAllPodcasts()
+		if nameOrID := c.String("name"); nameOrID != "" {
+			p, err := cfg.GetPodcastByNameOrID(nameOrID)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			podcasts = []*Podcast{p}
+		}
+		if err := writeLocalFeeds(podcasts, c.String("dir"), c.String("merged")); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// 'serve' - command
+func cmdServe() cli.Command {
+	cmd := cli.Command{}
+	cmd.Name = "serve"
+	cmd.Usage = "serve downloaded files, feeds and OPML over http"
+	cmd.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "listen, l",
+			Usage: "Listen address, overrides listen-address setting",
+		},
+	}
+	cmd.Action = func(c *cli.Context) error {
+		settings, err := cfg.GetGlobalSettings()
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		if c.IsSet("listen") {
+			settings.ListenAddress = c.String("listen")
+		}
+		if err := serve(settings); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+// 'daemon' - command
+func cmdDaemon() cli.Command {
+	cmd := cli.Command{}
+	cmd.Name = "daemon"
+	cmd.Usage = "sync podcasts periodically according to interval setting"
+	cmd.Action = func(c *cli.Context) error {
+		if err := withConfigLock(runDaemon); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
 		return nil
 	}
 
@@ -229,6 +428,10 @@ func cmdSync() cli.Command {
 			Value: "",
 			Usage: "Name or Id of podacast to sync",
 		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Only print destination path, size and url of files, which would be downloaded",
+		},
 	}
 	cmd.Action = func(c *cli.Context) error {
 		var date time.Time
@@ -243,8 +446,19 @@ func cmdSync() cli.Command {
 		podcastCount := c.Int("count")
 		nameOrID := c.String("name")
 
+		// dry run changes nothing, so it does not wait for running sync
+		if c.Bool("dry-run") {
+			if err := syncPodcasts(date, nameOrID, podcastCount, false, true); err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			return nil
+		}
+
 		log.Infof("Started at %s", time.Now())
-		if err = syncPodcasts(date, nameOrID, podcastCount, false); err != nil {
+		err = withConfigLock(func() error {
+			return syncPodcasts(date, nameOrID, podcastCount, false, false)
+		})
+		if err != nil {
 			return cli.NewExitError(err.Error(), 1)
 		}
 		log.Infof("Finished at %s", time.Now())
@@ -253,3 +467,20 @@ func cmdSync() cli.Command {
 
 	return cmd
 }
+
+// 'validate' - command
+func cmdValidate() cli.Command {
+	cmd := cli.Command{}
+	cmd.Name = "validate"
+	cmd.Usage = "check config: filters, templates, settings names and download paths"
+	cmd.Action = func(c *cli.Context) error {
+		errs := cfg.Validate()
+		reportValidation(errs)
+		if len(errs) > 0 {
+			return cli.NewExitError(fmt.Sprintf("%d problems found in %s", len(errs), cfg.configPath), 1)
+		}
+		return nil
+	}
+
+	return cmd
+}
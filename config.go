@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -21,6 +22,16 @@ const (
 #    {{ItemDescription}} Podcast Item description
 #    {{ItemPubDate}}     Podcast item publish date
 #    {{ItemFileName}}    Podcast item filename from url
+#    {{ItemExt}}         Podcast item file extension with leading dot, e.g. '.mp3'
+#    {{ItemIndex}}       Podcast item number in feed by publish date, oldest is 1
+#    {{ItemSeason}}      Podcast item season number (podcast:season or itunes:season),
+#                        padded to two digits, e.g. '02', empty if unknown
+#    {{ItemEpisode}}     Podcast item episode number (podcast:episode or itunes:episode), e.g. '05'
+#    {{ItemPersons}}     Podcast item hosts and guests (podcast:person), comma separated
+#    {{ItemEpisodeType}} Podcast item type (itunes:episodeType): full, trailer or bonus
+#    {{ItemDuration}}    Podcast item duration in seconds (itunes:duration)
+#    {{ItemExplicit}}    Podcast item is explicit (itunes:explicit): true or false
+#    {{ItemAuthor}}      Podcast item author (itunes:author)
 #    {{CurrentDate}}     now date
 #
 # Available settings:
@@ -28,8 +39,28 @@ const (
 #                            path sep is '/' , on win path will be adjusted
 #                            [required]
 #    separate-dir        save podcast items in seprate dir , following tokens can be used:
-#                            {{Title}}, {{Name}}, {{ItemPubDate}}, {{ItemTitle}}, {{CurrentDate}}
+#                            {{Title}}, {{Name}}, {{ItemPubDate}}, {{ItemTitle}}, {{CurrentDate}},
+#                            {{ItemFileName}}, {{ItemExt}}, {{ItemIndex}},
+#                            {{ItemSeason}}, {{ItemEpisode}}, {{ItemPersons}}, {{ItemEpisodeType}},
+#                            {{ItemDuration}}, {{ItemExplicit}}, {{ItemAuthor}}
 #                            path sep is '/' , on win path will be adjusted
+#                            path is always inside download-path, '..' elements are dropped,
+#                            characters not allowed in file names are replaced by '_'
+#    file-name           file name for podcast items, following tokens can be used:
+#                            {{Title}}, {{Name}}, {{ItemPubDate}}, {{ItemTitle}}, {{CurrentDate}},
+#                            {{ItemFileName}}, {{ItemExt}}, {{ItemIndex}},
+#                            {{ItemSeason}}, {{ItemEpisode}}, {{ItemPersons}}, {{ItemEpisodeType}},
+#                            {{ItemDuration}}, {{ItemExplicit}}, {{ItemAuthor}}
+#                            Example: {{ItemPubDate}} - {{ItemTitle}}{{ItemExt}}
+#                                     S{{ItemSeason}}E{{ItemEpisode}} - {{ItemTitle}}{{ItemExt}}
+#                            characters not allowed in file names are replaced by '_',
+#                            if file exists already, counter is added: 'name (2).mp3'
+#                            default is file name from url
+#    cache-path          path to store download history of podcasts
+#                            default is '.gopoddl_cache' near config file
+#                            items older than --date or, on first sync, than last sync are recorded
+#                            as seen and never downloaded ('reset' forgets them), items skipped
+#                            by filter, mtype or count are checked again by each sync
 #    disable             disable podcast
 #    date-format         tokens date format
 #                            Format : 20060102, 2006 - year, 01 - month, 02 - day
@@ -38,17 +69,107 @@ const (
 #    filter              filter for podcasts
 #                        if condition matched, podcast item will be downloaded
 #                        following tokens can be used:
-#                            {{ItemTitle}}, {{ItemUrl}}, {{ItemDescription}}
+#                            {{ItemTitle}}, {{ItemUrl}}, {{ItemDescription}},
+#                            {{ItemSeason}}, {{ItemEpisode}}, {{ItemPersons}}, {{ItemEpisodeType}},
+#                            {{ItemDuration}}, {{ItemExplicit}}, {{ItemAuthor}},
+#                            {{ItemSize}} - enclosure size in bytes,
+#                            {{ItemPubDate}} - publish date as 2006-01-02 (date-format is not used)
 #                        Format:
-#                            <string> [not] in [suffix|prefix] <VAR> [and|or] ....
+#                            <string> [not] [icase] in [suffix|prefix] <VAR> [and|or] ....
+#                            <VAR> [not] [icase] matches <regexp> [and|or] ....
+#                            <VAR> [not] [icase] =|!=|<|<=|>|>= <value> [and|or] ....
+#                            not ( <condition> ) [and|or] ....
+#                            'and' has higher precedence than 'or', use () to change it
 #                        Example:
 #                            "'Day' not in {{ItemDescription}} or 'Day' not in {{ItemTitle}}"
 #                            all podcast with 'Day' in title or in descripion will be ignored
+#                            "{{ItemTitle}} matches '^Episode [0-9]+'"
+#                            all podcast with title like 'Episode 12' will be downloaded
+#                            "'bonus' icase in {{ItemTitle}}"
+#                            all podcast with 'bonus', 'Bonus', 'BONUS', ... in title will be downloaded
+#                            "'trailer' not in {{ItemEpisodeType}}" or "{{ItemEpisodeType}} != 'trailer'"
+#                            trailers will be skipped
+#                            "{{ItemDuration}} > 10m and {{ItemPubDate}} >= '2024-01-01'"
+#                            podcast items longer than 10 minutes published since 2024 will be downloaded
 #                        Keywords:
-#                            not, in, prefix, suffix or, and , (), ', "
+#                            not, icase, in, prefix, suffix, matches, or, and , (), ', "
 #                            in     - search like '%string%'
 #                            prefix - search like '%string'
 #                            suffix - search like 'string%'
+#                            matches - search by regular expression (https://golang.org/s/re2syntax)
+#                            icase  - ignore case for next in, matches or comparison
+#                            =, !=, <, <=, >, >= - compare values as numbers, durations (10m, 1h30m,
+#                                     plain number is seconds) or dates (2006-01-02, 20060102, 2006/01/02),
+#                                     if both values can be parsed so, as strings otherwise;
+#                                     unknown (empty) value is never less or greater than other value
+#    filter-case-insensitive
+#                        all filter expressions ignore case, true or false
+#    retry-count         number of retries for failed downloads, 0 disables retries
+#                            only timeouts, server errors (5xx) and broken connections are retried
+#    retry-backoff       delay before first retry, doubled for each next retry, e.g. 5s,
+#                            other files are downloaded meanwhile
+#    retry-backoff-max   retry delay limit, e.g. 5m
+#    tags                write metadata tags to downloaded files, ID3v2 for mp3, iTunes atoms for m4a/mp4
+#                            true - default tags, false or empty - do not change files
+#                            or comma separated list of field=format, listed fields override defaults:
+#                            artist={{Title}}, album={{Title}}, title={{ItemTitle}}, date={{ItemPubDate}},
+#                            comment={{ItemDescription}}, genre=Podcast, track={{ItemIndex}}
+#                            empty format removes field, tokens are the same as for file-name
+#                            and {{ItemDescription}}
+#                        Example: "title={{ItemIndex}}. {{ItemTitle}}, comment="
+#    keep-count          keep only newest N downloaded files, 0 means all
+#    keep-days           keep only files published during last N days, 0 means all
+#    keep-size           keep newest files up to total size, e.g. 500M or 2G, empty means no limit
+#                            only files downloaded by gopoddl are removed, see 'prune' command
+#    prune-on-sync       remove files not kept by keep-* settings after sync, true or false
+#    playlist            write playlist of downloaded files after sync, empty means no playlist
+#                            following tokens can be used: {{Name}}, {{Title}}, {{CurrentDate}}
+#                            relative path is relative to download-path,
+#                            .pls extension writes PLS playlist, m3u is written otherwise
+#                        Example: {{Name}}.m3u8
+#    public-base-url     url of download-path on web server, used for enclosures of feeds written by 'feed'
+#                        Example: http://192.168.1.2/podcasts
+#    interval            sync interval of 'daemon', default 6h, empty means podcast is not synced by daemon
+#                            duration: 30m, 6h, 24h
+#                            or cron expression: minute hour day-of-month month day-of-week
+#                        Example: "0 6,18 * * *" - sync at 6:00 and 18:00
+#    on-download         command run by shell after item is downloaded, tokens are passed as
+#                            environment variables: {{ItemTitle}} -> $PODDL_ITEM_TITLE, ...
+#                            and $PODDL_ITEM_PATH, $PODDL_ITEM_SIZE, $PODDL_ITEM_PUB_TIME (RFC3339)
+#                            values longer than 32KiB, e.g. $PODDL_ITEM_DESCRIPTION, are truncated
+#                        Example: rsync "$PODDL_ITEM_PATH" nas:/podcasts/
+#    on-podcast-complete command run after all items of podcast are downloaded, environment variables:
+#                            $PODDL_NAME, $PODDL_TITLE, $PODDL_DOWNLOAD_PATH, $PODDL_DOWNLOADED, $PODDL_FAILED
+#    hook-timeout        hook is killed if it runs longer, default 5m, 0 means no limit
+#    hook-fail-episode   failed on-download hook marks item as failed, item file is removed
+#                            and downloaded again by next sync, true or false
+#    extras              download additional files of item next to it, comma separated list of:
+#                            transcript - podcast:transcript, saved as <file>.vtt, .srt, ...
+#                            chapters   - podcast:chapters, saved as <file>.chapters.json
+#                            empty means no extras, failed extras do not fail item
+#                        Example: transcript,chapters
+#    max-bandwidth       download rate limit of podcast, e.g. 500KB/s or 2MB/s, empty or 0 means no limit
+#                            in default section it limits all downloads together too
+#    bandwidth-schedule  rate limits for times of day, comma separated list of HH:MM-HH:MM=rate,
+#                            max-bandwidth is used out of listed periods, 0 means no limit,
+#                            rate is changed for running downloads too
+#                        Example: full speed at night and 500KB/s otherwise:
+#                            max-bandwidth = 500KB/s
+#                            bandwidth-schedule = 01:00-06:00=0
+#
+# Global settings (cannot be overridden per podcast):
+#    max-parallel-downloads  number of files downloaded at the same time, default 4
+#    max-parallel-per-host   number of files downloaded at the same time from one host,
+#                            0 means no limit, default 2
+#    new-playlist            playlist of files downloaded by last sync, empty means no playlist
+#                            {{CurrentDate}} token can be used, e.g. ~/podcasts/new.m3u8
+#                            relative path is relative to dir of config file
+#    listen-address          address of 'serve' http server, default localhost:8080
+#                            use :8080 to listen on all interfaces
+#    serve-user              user for basic auth of 'serve', empty disables auth
+#    serve-password          password for basic auth of 'serve'
+#    on-sync-complete        command run after sync, environment variables:
+#                            $PODDL_PODCASTS, $PODDL_DOWNLOADED, $PODDL_FAILED
 #
 `
 )
@@ -61,20 +182,94 @@ var (
 
 // Podcast - mandatory settings, set per podcast
 type Podcast struct {
-	Name            string    `ini:"-"`
-	Url             string    `ini:"url"`
-	LastSynced      time.Time `ini:"last-synced"`
+	Name            string    `ini:"-" json:"name"`
+	Url             string    `ini:"url" json:"url"`
+	LastSynced      time.Time `ini:"last-synced" json:"last-synced"`
 	PodcastSettings `ini:"Podcast"`
+
+	// feed cache validators from last sync
+	FeedETag         string `ini:"feed-etag" json:"feed-etag"`
+	FeedLastModified string `ini:"feed-last-modified" json:"feed-last-modified"`
 }
 
 // PodcastSettings - global settings, can be customized per podcast
 type PodcastSettings struct {
-	DownloadPath string `ini:"download-path"`
-	SeparateDir  string `ini:"separate-dir"`
-	Disabled     bool   `ini:"disabled"`
-	DateFormat   string `ini:"date-format"`
-	Filter       string `ini:"filter"`
-	Mtype        string `ini:"mtype"`
+	DownloadPath string `ini:"download-path" json:"download-path"`
+	SeparateDir  string `ini:"separate-dir" json:"separate-dir"`
+	FileName     string `ini:"file-name" json:"file-name"`
+	Disabled     bool   `ini:"disabled" json:"disabled"`
+	DateFormat   string `ini:"date-format" json:"date-format"`
+	Filter       string `ini:"filter" json:"filter"`
+	Mtype        string `ini:"mtype" json:"mtype"`
+	CachePath    string `ini:"cache-path" json:"cache-path"`
+
+	FilterCaseInsensitive bool `ini:"filter-case-insensitive" json:"filter-case-insensitive"`
+
+	RetryCount      int           `ini:"retry-count" json:"retry-count"`
+	RetryBackoff    time.Duration `ini:"retry-backoff" json:"retry-backoff"`
+	RetryMaxBackoff time.Duration `ini:"retry-backoff-max" json:"retry-backoff-max"`
+
+	Tags string `ini:"tags" json:"tags"`
+
+	KeepCount   int    `ini:"keep-count" json:"keep-count"`
+	KeepDays    int    `ini:"keep-days" json:"keep-days"`
+	KeepSize    string `ini:"keep-size" json:"keep-size"`
+	PruneOnSync bool   `ini:"prune-on-sync" json:"prune-on-sync"`
+
+	Playlist string `ini:"playlist" json:"playlist"`
+
+	PublicBaseUrl string `ini:"public-base-url" json:"public-base-url"`
+
+	Interval string `ini:"interval" json:"interval"`
+
+	OnDownload        string        `ini:"on-download" json:"on-download"`
+	OnPodcastComplete string        `ini:"on-podcast-complete" json:"on-podcast-complete"`
+	HookTimeout       time.Duration `ini:"hook-timeout" json:"hook-timeout"`
+	HookFailEpisode   bool          `ini:"hook-fail-episode" json:"hook-fail-episode"`
+
+	Extras string `ini:"extras" json:"extras"`
+
+	MaxBandwidth      string `ini:"max-bandwidth" json:"max-bandwidth"`
+	BandwidthSchedule string `ini:"bandwidth-schedule" json:"bandwidth-schedule"`
+}
+
+// GlobalSettings - settings, which are set in default section only
+type GlobalSettings struct {
+	MaxParallelDownloads int `ini:"max-parallel-downloads"`
+	MaxParallelPerHost   int `ini:"max-parallel-per-host"`
+
+	NewPlaylist string `ini:"new-playlist"`
+
+	ListenAddress string `ini:"listen-address"`
+	ServeUser     string `ini:"serve-user"`
+	ServePassword string `ini:"serve-password"`
+
+	OnSyncComplete string        `ini:"on-sync-complete"`
+	HookTimeout    time.Duration `ini:"hook-timeout"`
+
+	MaxBandwidth      string `ini:"max-bandwidth"`
+	BandwidthSchedule string `ini:"bandwidth-schedule"`
+}
+
+// defaultGlobalSettings are used if setting is missing in config
+func defaultGlobalSettings() *GlobalSettings {
+	return &GlobalSettings{
+		MaxParallelDownloads: 4,
+		MaxParallelPerHost:   2,
+		ListenAddress:        "localhost:8080",
+		HookTimeout:          5 * time.Minute,
+	}
+}
+
+// podcastSettingsDefaults returns settings, which are used if setting is missing in config
+func podcastSettingsDefaults() *PodcastSettings {
+	return &PodcastSettings{
+		RetryCount:      3,
+		RetryBackoff:    5 * time.Second,
+		RetryMaxBackoff: 5 * time.Minute,
+		Interval:        "6h",
+		HookTimeout:     5 * time.Minute,
+	}
 }
 
 // CreateDefaultConfig creates inital configurtion and save it to file
@@ -83,16 +278,21 @@ func CreateDefaultConfig(filePath string) error {
 	defaultSection := cfg.Section("")
 	defaultSection.Comment = defaultComment
 
-	defaultSettings := new(PodcastSettings)
+	defaultSettings := podcastSettingsDefaults()
 	defaultSettings.DownloadPath = expandPath("~/")
 	defaultSettings.Disabled = false
 	defaultSettings.SeparateDir = ""
+	defaultSettings.FileName = ""
 	defaultSettings.DateFormat = "20060102"
 	defaultSettings.Mtype = "audio"
 	defaultSettings.Filter = ""
+	defaultSettings.FilterCaseInsensitive = false
 	if err := defaultSection.ReflectFrom(defaultSettings); err != nil {
 		return err
 	}
+	if err := defaultSection.ReflectFrom(defaultGlobalSettings()); err != nil {
+		return err
+	}
 	return cfg.SaveTo(filePath)
 }
 
@@ -101,8 +301,20 @@ type Config struct {
 	cfg        *ini.File
 }
 
-// NewConfig creates config object from file
+// NewConfig creates config object from file, filters and templates of podcasts are checked
 func NewConfig(configPath string) (*Config, error) {
+	c, err := loadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if errs := c.checkPodcasts(templateSettings); len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+// loadConfig creates config object from file without checks
+func loadConfig(configPath string) (*Config, error) {
 	var err error
 	c := new(Config)
 	c.configPath = configPath
@@ -114,14 +326,43 @@ func NewConfig(configPath string) (*Config, error) {
 	return c, nil
 }
 
-// UpdatePodcast updates last-synced for podacast to config file and saves it disk
+// UpdatePodcast updates last-synced and feed validators for podacast to config file and saves it disk.
+// File is read again, so changes made by other commands since config was loaded (e.g. while daemon runs) are kept
 func (c *Config) UpdatePodcast(podcast *Podcast) error {
-	c.cfg.Section(podcast.Name).Key("last-synced").SetValue(podcast.LastSynced.Format(time.RFC3339))
-	return c.cfg.SaveTo(c.configPath)
+	setSyncedKeys(c.cfg.Section(podcast.Name), podcast)
+
+	onDisk, err := ini.InsensitiveLoad(c.configPath)
+	if err != nil {
+		return err
+	}
+	section, err := onDisk.GetSection(podcast.Name)
+	if err != nil {
+		// podcast was removed meanwhile
+		return nil
+	}
+	setSyncedKeys(section, podcast)
+	return onDisk.SaveTo(c.configPath)
+}
+
+// setSyncedKeys sets last-synced and feed validators of podcast section
+func setSyncedKeys(section *ini.Section, podcast *Podcast) {
+	section.Key("last-synced").SetValue(podcast.LastSynced.Format(time.RFC3339))
+	if podcast.FeedETag != "" || section.HasKey("feed-etag") {
+		section.Key("feed-etag").SetValue(podcast.FeedETag)
+	}
+	if podcast.FeedLastModified != "" || section.HasKey("feed-last-modified") {
+		section.Key("feed-last-modified").SetValue(podcast.FeedLastModified)
+	}
 }
 
 // AddPodcast - adds new podcast to config and saves it disk
 func (c *Config) AddPodcast(name, url string) error {
+	return c.AddPodcastWithSettings(name, url, nil)
+}
+
+// AddPodcastWithSettings - adds new podcast with own settings to config and saves it disk,
+// settings keys are PodcastSettings keys: filter, mtype, ...
+func (c *Config) AddPodcastWithSettings(name, url string, settings map[string]string) error {
 	var emptyDate time.Time
 	_, err := c.cfg.GetSection(name)
 	if err == nil {
@@ -129,9 +370,27 @@ func (c *Config) AddPodcast(name, url string) error {
 	}
 	c.cfg.Section(name).Key("url").SetValue(url)
 	c.cfg.Section(name).Key("last-synced").SetValue(emptyDate.Format(time.RFC3339))
+	for _, key := range sortedKeys(settings) {
+		c.cfg.Section(name).Key(key).SetValue(settings[key])
+	}
 	return c.cfg.SaveTo(c.configPath)
 }
 
+// GetPodcastOwnSettings returns settings set in podcast section, defaults are not included
+func (c *Config) GetPodcastOwnSettings(name string) (map[string]string, error) {
+	section, err := c.cfg.GetSection(name)
+	if err != nil {
+		return nil, ErrPodcastWasNotFound
+	}
+	settings := map[string]string{}
+	for key, value := range section.KeysHash() {
+		if podcastSettingKeys()[key] {
+			settings[key] = value
+		}
+	}
+	return settings, nil
+}
+
 // RemovePodcast  removes podcast from config and saves it disk
 func (c *Config) RemovePodcast(name string) error {
 	_, err := c.cfg.GetSection(name)
@@ -143,16 +402,46 @@ func (c *Config) RemovePodcast(name string) error {
 	return c.cfg.SaveTo(c.configPath)
 }
 
-// ResetAll reset LastSynced to nil for all podcasts
+// ResetAll reset LastSynced and feed validators to nil for all podcasts
+// and forgets seen items in history, downloaded items are kept
 func (c *Config) ResetAll() error {
 	var emptyTime time.Time
 	for _, podcast := range c.GetAllPodcasts() {
 		podcast.LastSynced = emptyTime
+		podcast.FeedETag = ""
+		podcast.FeedLastModified = ""
 		c.UpdatePodcast(podcast)
+
+		history, err := LoadHistory(c.HistoryPath(podcast))
+		if err != nil {
+			return err
+		}
+		history.ForgetSeen()
+		if err := history.Save(); err != nil {
+			return err
+		}
 	}
 	return c.cfg.SaveTo(c.configPath)
 }
 
+// HistoryPath returns path to download history file of podcast
+func (c *Config) HistoryPath(podcast *Podcast) string {
+	cachePath := podcast.CachePath
+	if cachePath == "" {
+		cachePath = filepath.Join(filepath.Dir(c.configPath), ".gopoddl_cache")
+	}
+	return filepath.Join(expandPath(cachePath), sanitizeFileName(podcast.Name)+".json")
+}
+
+// GetGlobalSettings returns settings from default section
+func (c *Config) GetGlobalSettings() (*GlobalSettings, error) {
+	settings := defaultGlobalSettings()
+	if err := c.cfg.Section(ini.DEFAULT_SECTION).MapTo(settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
 // PodcastLen returns podcasts count
 func (c *Config) PodcastLen() int {
 	// deduct defult section
@@ -162,7 +451,7 @@ func (c *Config) PodcastLen() int {
 // GetPodcastByName retuns podcast settings by name
 func (c *Config) GetPodcastByName(name string) (*Podcast, error) {
 	// load default section
-	pDefault := new(PodcastSettings)
+	pDefault := podcastSettingsDefaults()
 	if err := c.cfg.Section(ini.DEFAULT_SECTION).MapTo(pDefault); err != nil {
 		return nil, err
 	}
@@ -179,10 +468,19 @@ func (c *Config) GetPodcastByName(name string) (*Podcast, error) {
 	if err := section.MapTo(podcast); err != nil {
 		return nil, err
 	}
+	podcast.expandPaths()
 
 	return podcast, nil
 }
 
+// expandPaths expands '~' and environment variables of download-path,
+// so all commands use same absolute path
+func (s *PodcastSettings) expandPaths() {
+	if s.DownloadPath != "" {
+		s.DownloadPath = expandPath(s.DownloadPath)
+	}
+}
+
 // GetPodcastByNameOrID retuns podcast settings by name or index
 func (c *Config) GetPodcastByNameOrID(nameOrID string) (*Podcast, error) {
 	p, err := c.GetPodcastByName(nameOrID)
@@ -212,7 +510,7 @@ func (c *Config) GetPodcastByIndex(index int) (*Podcast, error) {
 func (c *Config) GetAllPodcasts() []*Podcast {
 	podcasts := []*Podcast{}
 	for _, sectionName := range c.cfg.SectionStrings() {
-		if sectionName == ini.DEFAULT_SECTION {
+		if isDefaultSection(sectionName) {
 			continue
 		}
 		p, err := c.GetPodcastByName(sectionName)
@@ -3,7 +3,9 @@ package main
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"gopkg.in/stretchr/testify.v1/assert"
 )
@@ -23,6 +25,7 @@ url         = http://localgost/rss.xml
 filter      = 'Хрусталев' in {{ItemTitle}}
 last-synced = 2016-08-11T14:21:57+03:00
 mtype         = video
+filter-case-insensitive = true
 `)
 	tmpfile, err := ioutil.TempFile("", "testconfig")
 	if err != nil {
@@ -54,5 +57,63 @@ mtype         = video
 	assert.Equal(t, "2006Jan", p.DateFormat, "Pocast.DateFormat  is incorrect")
 	assert.Equal(t, "video", p.Mtype, "Pocast.Mtype  is incorrect")
 	assert.Equal(t, "'Хрусталев' in {{ItemTitle}}", p.Filter, "Podcast.Filter is incorrect")
+	assert.Equal(t, true, p.FilterCaseInsensitive, "Podcast.FilterCaseInsensitive is incorrect")
 
 }
+
+func TestUpdatePodcastKeepsOtherChanges(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testconfig")
+	if err != nil {
+		t.Fatal("Failed to create tmp file", err)
+	}
+	defer os.Remove(tmpfile.Name()) // clean up
+	tmpfile.WriteString("download-path = /data/Podcasts\n\n[one]\nurl = http://localhost/one.xml\n")
+	tmpfile.Close()
+
+	daemonCfg, err := NewConfig(tmpfile.Name())
+	if err != nil {
+		t.Fatal("Failed to read config", err)
+	}
+	// other command changes config, while it's loaded
+	otherCfg, err := NewConfig(tmpfile.Name())
+	if err != nil {
+		t.Fatal("Failed to read config", err)
+	}
+	if err := otherCfg.AddPodcast("two", "http://localhost/two.xml"); err != nil {
+		t.Fatal("Failed to add podcast", err)
+	}
+
+	podcast, _ := daemonCfg.GetPodcastByName("one")
+	podcast.LastSynced = time.Date(2016, 8, 11, 14, 21, 57, 0, time.UTC)
+	podcast.FeedETag = "v1"
+	assert.NoError(t, daemonCfg.UpdatePodcast(podcast))
+
+	c, err := NewConfig(tmpfile.Name())
+	if err != nil {
+		t.Fatal("Failed to read config", err)
+	}
+	assert.Equal(t, 2, c.PodcastLen(), "added podcast should be kept")
+	p, _ := c.GetPodcastByName("one")
+	assert.True(t, podcast.LastSynced.Equal(p.LastSynced))
+	assert.Equal(t, "v1", p.FeedETag)
+}
+
+func TestDownloadPathExpanded(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testconfig")
+	if err != nil {
+		t.Fatal("Failed to create tmp file", err)
+	}
+	defer os.Remove(tmpfile.Name()) // clean up
+	tmpfile.WriteString("download-path = ~/podcasts\n\n[one]\nurl = http://localhost/one.xml\n")
+	tmpfile.Close()
+
+	c, err := NewConfig(tmpfile.Name())
+	if err != nil {
+		t.Fatal("Failed to read config", err)
+	}
+	p, _ := c.GetPodcastByName("one")
+	assert.Equal(t, expandPath("~/podcasts"), p.DownloadPath)
+	assert.True(t, filepath.IsAbs(p.DownloadPath), "download path should be absolute")
+	d, _ := c.defaultPodcast()
+	assert.Equal(t, p.DownloadPath, d.DownloadPath, "validate should check same path")
+}
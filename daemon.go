@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// syncStopped is closed when running sync should stop: new downloads are not started,
+// started ones are completed
+var (
+	syncStopped  = make(chan struct{})
+	stopSyncOnce sync.Once
+)
+
+// stopSync asks running sync to stop
+func stopSync() {
+	stopSyncOnce.Do(func() { close(syncStopped) })
+}
+
+// daemonMaxWait limits sleep between checks, so clock changes and config edits are noticed
+const daemonMaxWait = time.Hour
+
+// duePodcasts returns enabled podcasts, which should be synced at now, and time of next check
+func duePodcasts(podcasts []*Podcast, lastRun map[string]time.Time, now time.Time) ([]*Podcast, time.Time) {
+	due := []*Podcast{}
+	nextCheck := now.Add(daemonMaxWait)
+	for _, podcast := range podcasts {
+		if podcast.Disabled || podcast.Interval == "" {
+			continue
+		}
+		sched, err := parseSchedule(podcast.Interval)
+		if err != nil {
+			log.Warnf("%s: %v", podcast.Name, err)
+			continue
+		}
+		last, ok := lastRun[podcast.Name]
+		if !ok {
+			last = podcast.LastSynced
+		}
+		next := sched.next(last)
+		if !last.IsZero() && next.IsZero() {
+			// schedule does not match anymore
+			continue
+		}
+		if last.IsZero() || !next.After(now) {
+			due = append(due, podcast)
+			continue
+		}
+		if next.Before(nextCheck) {
+			nextCheck = next
+		}
+	}
+	return due, nextCheck
+}
+
+// runDaemon syncs podcasts according to their interval settings until SIGTERM or SIGINT is received.
+// SIGHUP reloads config, running sync is completed before
+func runDaemon() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	lastRun := map[string]time.Time{}
+	syncDone := make(chan []*Podcast, 1)
+	running := false
+	stopping := false
+	reloadPending := false
+
+	reload := func() {
+		newCfg, err := NewConfig(cfg.configPath)
+		if err != nil {
+			log.Warnf("Failed to reload config, old one is used: %v", err)
+			return
+		}
+		cfg = newCfg
+		log.Info("Config reloaded")
+	}
+
+	log.Infof("Daemon started, pid %d", os.Getpid())
+	for {
+		nextCheck := time.Now().Add(daemonMaxWait)
+		if !running {
+			var due []*Podcast
+			due, nextCheck = duePodcasts(cfg.GetAllPodcasts(), lastRun, time.Now())
+			if len(due) > 0 {
+				running = true
+				go func() {
+					log.Infof("Sync of %d podcasts started at %s", len(due), time.Now())
+					if err := syncPodcastList(due, time.Time{}, -1, false, false); err != nil {
+						log.Warnf("Sync failed: %v", err)
+					}
+					syncDone <- due
+				}()
+			}
+		}
+
+		timer := time.NewTimer(time.Until(nextCheck))
+		select {
+		case <-timer.C:
+
+		case synced := <-syncDone:
+			running = false
+			for _, podcast := range synced {
+				lastRun[podcast.Name] = time.Now()
+			}
+			log.Infof("Sync finished at %s", time.Now())
+			if err := output.Flush(); err != nil {
+				log.Warnf("output: %v", err)
+			}
+			if stopping {
+				timer.Stop()
+				return nil
+			}
+			if reloadPending {
+				reloadPending = false
+				reload()
+			}
+
+		case sig := <-signals:
+			switch {
+			case sig == syscall.SIGHUP && running:
+				log.Info("Config will be reloaded after sync")
+				reloadPending = true
+			case sig == syscall.SIGHUP:
+				reload()
+			case stopping: // second signal
+				timer.Stop()
+				log.Warn("Stopped, partially downloaded files are resumed by next sync")
+				return nil
+			case running:
+				stopping = true
+				stopSync()
+				log.Info("Stopping, waiting for started downloads, send signal again to stop immediately")
+			default:
+				timer.Stop()
+				return nil
+			}
+		}
+		timer.Stop()
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestDuePodcasts(t *testing.T) {
+	now := time.Date(2016, 8, 11, 12, 0, 0, 0, time.UTC)
+	newPodcast := func(name, interval string, lastSynced time.Time) *Podcast {
+		p := &Podcast{Name: name, LastSynced: lastSynced}
+		p.Interval = interval
+		return p
+	}
+	podcasts := []*Podcast{
+		newPodcast("never", "6h", time.Time{}),
+		newPodcast("late", "6h", now.Add(-7*time.Hour)),
+		newPodcast("soon", "6h", now.Add(-5*time.Hour)),
+		newPodcast("manual", "", time.Time{}),
+		newPodcast("cron", "0 13 * * *", now.Add(-time.Hour)),
+	}
+	disabled := newPodcast("disabled", "6h", time.Time{})
+	disabled.Disabled = true
+	podcasts = append(podcasts, disabled)
+
+	due, nextCheck := duePodcasts(podcasts, map[string]time.Time{}, now)
+	names := []string{}
+	for _, p := range due {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"never", "late"}, names)
+	assert.Equal(t, now.Add(time.Hour), nextCheck)
+
+	// schedule without next match after last sync is never due
+	ended := newPodcast("ended", "0 0 29 2 *", time.Date(2097, 3, 1, 0, 0, 0, 0, time.UTC))
+	due, _ = duePodcasts([]*Podcast{ended}, map[string]time.Time{}, now)
+	assert.Empty(t, due)
+
+	// last run of daemon is used instead of last sync
+	due, _ = duePodcasts(podcasts[:2], map[string]time.Time{"never": now, "late": now}, now)
+	assert.Empty(t, due)
+}
+
+func TestAcquireLock(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testlock")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+	path := filepath.Join(tmpDir, "config.ini.lock")
+
+	lock, err := acquireLock(path)
+	assert.NoError(t, err)
+	_, err = acquireLock(path)
+	assert.Error(t, err, "lock is held by this process")
+
+	assert.NoError(t, lock.release())
+	lock, err = acquireLock(path)
+	assert.NoError(t, err)
+	lock.release()
+
+	// lock of process, which does not exist, is stale
+	ioutil.WriteFile(path, []byte(strconv.Itoa(1<<30)+"\n"), 0666)
+	lock, err = acquireLock(path)
+	if assert.NoError(t, err) {
+		lock.release()
+	}
+}
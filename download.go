@@ -3,39 +3,87 @@ package main
 // github.com/cheggaaa/pb
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/cavaliercoder/grab"
 	"github.com/fatih/color"
 	"github.com/gosuri/uilive"
-	rss "github.com/jteeuwen/go-pkg-rss"
 )
 
-func getRss(podcast *Podcast) (*rss.Feed, error) {
+// ErrFeedNotModified is returned if feed was not changed since last sync
+var ErrFeedNotModified = errors.New("Feed was not modified")
 
-	feed := rss.New(1, true, nil, nil)
-	if err := feed.Fetch(podcast.Url, nil); err != nil {
-		return nil, err
+// feedValidators are cache validators of feed, used for conditional requests
+type feedValidators struct {
+	ETag         string
+	LastModified string
+}
+
+var feedClient = &http.Client{Timeout: 2 * time.Minute}
+
+// getFeed downloads and parses podcast feed, if conditional is set and feed was not changed
+// since last sync (server returns 304), ErrFeedNotModified is returned
+func getFeed(podcast *Podcast, conditional bool) (*FeedChannel, *feedValidators, error) {
+	req, err := http.NewRequest("GET", podcast.Url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conditional {
+		if podcast.FeedETag != "" {
+			req.Header.Set("If-None-Match", podcast.FeedETag)
+		}
+		if podcast.FeedLastModified != "" {
+			req.Header.Set("If-Modified-Since", podcast.FeedLastModified)
+		}
+	}
+
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil, ErrFeedNotModified
+	}
+	if resp.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("feed: bad response status: %s", resp.Status)
+	}
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	channel, err := parseFeed(podcast.Url, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	validators := &feedValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
 	}
-	return feed, nil
+	return channel, validators, nil
 }
 
-func getRssName(url string) (string, error) {
-	feed := rss.New(1, true, nil, nil)
-	if err := feed.Fetch(url, nil); err != nil {
+// getFeedName returns title of feed
+func getFeedName(url string) (string, error) {
+	channel, _, err := getFeed(&Podcast{Url: url}, false)
+	if err != nil {
 		return "", err
 	}
-	return feed.Channels[0].Title, nil
+	return channel.Title, nil
 }
 
-func syncPodcasts(startDate time.Time, nameOrID string, count int, chekMode bool) error {
-	allReqs := [][]*grab.Request{}
+func syncPodcasts(startDate time.Time, nameOrID string, count int, chekMode, dryRun bool) error {
 	podcasts := []*Podcast{}
-
 	if nameOrID == "" {
 		podcasts = cfg.GetAllPodcasts()
 	} else {
@@ -45,39 +93,67 @@ func syncPodcasts(startDate time.Time, nameOrID string, count int, chekMode bool
 		}
 		podcasts = append(podcasts, p)
 	}
+	return syncPodcastList(podcasts, startDate, count, chekMode, dryRun)
+}
+
+// syncPodcastList checks or downloads podcasts. Dry run is check, which reports
+// destination paths of items, nothing is downloaded and no files are created
+func syncPodcastList(podcasts []*Podcast, startDate time.Time, count int, chekMode, dryRun bool) error {
+	chekMode = chekMode || dryRun
+	allReqs := []*podcastRequests{}
+	synced := []*Podcast{}
+	usedPaths := map[string]bool{} // to avoid collisions between items
+	validators := map[*Podcast]*feedValidators{}
+	titles := map[*Podcast]string{} // channel titles for playlist names
 
 	for n, podcast := range podcasts {
 
 		var podcastList []*DownloadItem
 
+		history, err := LoadHistory(cfg.HistoryPath(podcast))
+		if err != nil {
+			reportPodcast(podcast, podcastList, n+1, err, chekMode)
+			continue
+		}
+
 		filter := MakeFilter(podcast)
 		filter.Count = count
 		filter.StartDate = startDate
+		filter.History = history
 
-		// download rss
-		feed, err := getRss(podcast)
+		// download feed, unchanged feed is skipped unless start date is set,
+		// dry run plans all items not downloaded yet, so feed is always downloaded
+		channel, feedValidators, err := getFeed(podcast, startDate.IsZero() && !dryRun)
 		if err != nil {
-			printPodcastInfo(podcast, podcastList, n+1, err)
-			continue
-		}
-
-		if len(feed.Channels) == 0 {
-			log.Warnf(fmt.Sprintf("No channels in %s", podcast.Name))
+			reportPodcast(podcast, podcastList, n+1, err, chekMode)
 			continue
 		}
 
 		// filter
-		podcastList, err = filter.FilterItems(feed.Channels[0])
+		podcastList, err = filter.FilterItems(channel)
 		if err != nil {
-			printPodcastInfo(podcast, podcastList, n+1, err)
+			reportPodcast(podcast, podcastList, n+1, err, chekMode)
 			continue
 		}
 
 		if chekMode {
-			printPodcastInfo(podcast, podcastList, n+1, err)
+			if dryRun {
+				planPaths(podcast, podcastList, usedPaths)
+			}
+			reportPodcast(podcast, podcastList, n+1, err, chekMode)
 			continue
 		}
 
+		// items older than start date or last sync are not new anymore,
+		// requested ones will be added to history after download
+		history.MarkSeen(filter.SkippedByDate(channel))
+		if err := history.Save(); err != nil {
+			return err
+		}
+		synced = append(synced, podcast)
+		validators[podcast] = feedValidators
+		titles[podcast] = channel.Title
+
 		// check for emptiness
 		if len(podcastList) == 0 {
 			log.Printf("%s : %s, %d files", color.CyanString("EMPTY"), podcast.Name, len(podcastList))
@@ -85,194 +161,533 @@ func syncPodcasts(startDate time.Time, nameOrID string, count int, chekMode bool
 		}
 
 		// create download requests
-		allReqs = append(allReqs, createRequests(podcast, podcastList))
+		allReqs = append(allReqs, createRequests(podcast, history, podcastList, usedPaths))
 
 	}
 
 	if !chekMode {
-		startDownload(allReqs)
+		settings, err := cfg.GetGlobalSettings()
+		if err != nil {
+			return err
+		}
+		failed, skipped := startDownload(allReqs, settings)
+		if output.IsText() {
+			printFailureSummary(failed)
+		}
+		if len(skipped) > 0 {
+			log.Warnf("Sync was stopped, %d files were not downloaded", len(skipped))
+		}
 
-		for _, podcast := range podcasts {
-			// FIXME: put right date according to rss or Item PubDate
+		failedPodcasts := map[*Podcast]bool{}
+		for _, status := range append(failed, skipped...) {
+			failedPodcasts[status.Podcast] = true
+		}
+
+		// LastSynced is used only until podcast has history,
+		// failed items are not in history, so they will be retried
+		for _, podcast := range synced {
 			podcast.LastSynced = time.Now()
+			// feed validators are saved only if all items were downloaded,
+			// otherwise unchanged feed would be skipped and failed items are never retried
+			if !failedPodcasts[podcast] {
+				podcast.FeedETag = validators[podcast].ETag
+				podcast.FeedLastModified = validators[podcast].LastModified
+			}
 			if err := cfg.UpdatePodcast(podcast); err != nil {
 				return err
 			}
 		}
+
+		// remove old files after new ones are downloaded
+		pruned := []*Podcast{}
+		for _, podcast := range synced {
+			if podcast.PruneOnSync {
+				pruned = append(pruned, podcast)
+			}
+		}
+		if err := prunePodcasts(pruned, false); err != nil {
+			return err
+		}
+
+		writePlaylists(synced, titles, allReqs, failed, settings)
+		runCompletionHooks(synced, titles, allReqs, append(failed, skipped...), settings)
 	}
 
 	return nil
 }
 
+// writePlaylists writes podcast playlists and playlist of new files,
+// playlist errors do not fail sync
+func writePlaylists(synced []*Podcast, titles map[*Podcast]string, allReqs []*podcastRequests, failed []*downloadStatus, settings *GlobalSettings) {
+	for _, podcast := range synced {
+		if podcast.Playlist == "" {
+			continue
+		}
+		history, err := LoadHistory(cfg.HistoryPath(podcast))
+		if err == nil {
+			err = writePodcastPlaylist(podcast, titles[podcast], history)
+		}
+		if err != nil {
+			log.Warnf("Failed to write playlist of %s: %v", podcast.Name, err)
+		}
+	}
+
+	if settings.NewPlaylist == "" {
+		return
+	}
+	failedItems := map[*DownloadItem]bool{}
+	for _, status := range failed {
+		failedItems[status.Item] = true
+	}
+	newItems := []*DownloadItem{}
+	for _, reqs := range allReqs {
+		for _, item := range reqs.Items {
+			// items skipped by stopped sync have no file
+			if !failedItems[item] && fileExists(item.Path) {
+				newItems = append(newItems, item)
+			}
+		}
+	}
+	// relative path is relative to config dir, same as default cache-path
+	if err := writeNewPlaylist(settings.NewPlaylist, filepath.Dir(cfg.configPath), newItems); err != nil {
+		log.Warnf("Failed to write playlist of new files: %v", err)
+	}
+}
+
+// reportPodcast prints podcast state or emits it to machine readable output
+func reportPodcast(podcast *Podcast, podcastList []*DownloadItem, index int, err error, chekMode bool) {
+	switch {
+	case output.IsText():
+		printPodcastInfo(podcast, podcastList, index, err)
+	case chekMode:
+		output.Emit(newCheckRecord(podcast, podcastList, index, err))
+	case err != nil && err != ErrFeedNotModified:
+		output.Emit(&syncEvent{
+			Event:   "feed-failed",
+			Time:    time.Now(),
+			Podcast: podcast.Name,
+			Url:     podcast.Url,
+			Error:   err.Error(),
+		})
+	}
+}
+
 func printPodcastInfo(podcast *Podcast, podcastList []*DownloadItem, index int, err error) {
 
 	status := ""
 	num := color.MagentaString("[" + strconv.Itoa(index) + "] ")
-	if err != nil {
+	if err == ErrFeedNotModified {
+		status = color.CyanString("NOT MODIFIED")
+	} else if err != nil {
 		status = color.RedString("FAIL")
 	} else {
-		color.GreenString("OK")
+		status = color.GreenString("OK")
 	}
 
 	log.Printf("%s %s", num, podcast.Name)
 	log.Printf("\t* Url             : %s %s", podcast.Url, status)
-	if err != nil {
+	if err == ErrFeedNotModified {
+		log.Printf("\t* Awaiting files  : 0 (no new items)")
+	} else if err != nil {
 		log.Warnf("Error: %s", err)
 	} else {
 		log.Printf("\t* Awaiting files  : %d", len(podcastList))
-		for k, podcast := range podcastList {
-			log.Printf("\t\t* [%d] : %s", k, podcast.ItemTitle)
+		for k, item := range podcastList {
+			log.Printf("\t\t* [%d] : %s", k, item.ItemTitle)
+			// paths are planned by dry run
+			if item.Path != "" {
+				printPlannedItem(item)
+			}
 		}
 	}
 }
 
-func createRequests(podcast *Podcast, podcastList []*DownloadItem) []*grab.Request {
-	reqs := []*grab.Request{}
+// podcastRequests holds download requests of one podcast,
+// Requests[i] downloads Items[i]
+type podcastRequests struct {
+	Podcast  *Podcast
+	History  *History
+	Retry    retryPolicy
+	Items    []*DownloadItem
+	Requests []*grab.Request
+}
+
+// printPlannedItem prints destination path, size and url of item
+func printPlannedItem(item *DownloadItem) {
+	size := "unknown size"
+	if item.Size > 0 {
+		size = formatSize(item.Size)
+	}
+	log.Printf("\t\t\t%s (%s)", item.Path, size)
+	log.Printf("\t\t\t<- %s", item.Url)
+	for _, extra := range item.Extras {
+		log.Printf("\t\t\t%s (%s) <- %s", extra.Path, extra.Kind, extra.Url)
+	}
+}
+
+// planPaths sets destination paths of items, paths of existing files
+// and of other planned items are not reused. Nothing is created on disk
+func planPaths(podcast *Podcast, podcastList []*DownloadItem, usedPaths map[string]bool) {
 	for _, entry := range podcastList {
-		// create dir for each entry, path is set in filter
-		// according to rules in configuration
+		// dir of each entry is set in filter according to rules in configuration
 		entryDownloadPath := filepath.Join(podcast.DownloadPath, entry.Dir)
-		if !fileExists(entryDownloadPath) {
-			if err := os.MkdirAll(entryDownloadPath, 0777); err != nil {
-				log.Fatal(err)
-				continue
-			}
+
+		// do not overwrite other items with same name
+		entry.Filename = uniqueFileName(entryDownloadPath, entry.Filename, usedPaths)
+		entry.Path = filepath.Join(entryDownloadPath, entry.Filename)
+		setExtraPaths(entry)
+	}
+}
+
+func createRequests(podcast *Podcast, history *History, podcastList []*DownloadItem, usedPaths map[string]bool) *podcastRequests {
+	reqs := &podcastRequests{
+		Podcast: podcast,
+		History: history,
+		Retry: retryPolicy{
+			Count:      podcast.RetryCount,
+			Backoff:    podcast.RetryBackoff,
+			MaxBackoff: podcast.RetryMaxBackoff,
+		},
+	}
+	planPaths(podcast, podcastList, usedPaths)
+	for _, entry := range podcastList {
+		// create dir for each entry, item is skipped, if dir cannot be created
+		if err := os.MkdirAll(filepath.Dir(entry.Path), 0777); err != nil {
+			log.Warnf("%s: %v", podcast.Name, err)
+			continue
 		}
 
+		// download to part file, it's kept on error to resume on next attempt
 		req, _ := grab.NewRequest(entry.Url)
-		req.Filename = filepath.Join(entryDownloadPath, entry.Filename)
+		req.Filename = entry.Path + partSuffix
 		req.Size = uint64(entry.Size)
-		req.RemoveOnError = true
-		reqs = append(reqs, req)
+		req.RemoveOnError = false
+		reqs.Items = append(reqs.Items, entry)
+		reqs.Requests = append(reqs.Requests, req)
 	}
 	return reqs
 }
 
-func startDownload(downloadReqs [][]*grab.Request) {
-	requestCount := len(downloadReqs)
-	statusQueue := make(chan *downloadStatus, requestCount)
-	doneQueue := make(chan bool, requestCount)
+// startDownload downloads all requests, returns failed ones
+// and skipped ones, which were not started, because sync was stopped
+func startDownload(downloadReqs []*podcastRequests, settings *GlobalSettings) (failed, skipped []*downloadStatus) {
+	totalFiles := 0
+	for _, podcastReq := range downloadReqs {
+		totalFiles += len(podcastReq.Requests)
+	}
+
+	// buffered, so workers are never blocked by monitoring
+	startedQueue := make(chan *downloadStatus, totalFiles)
+	completedQueue := make(chan *downloadStatus, totalFiles)
+
+	clients := downloadClients(downloadReqs, settings)
+	queue := newDownloadQueue(downloadReqs, settings.MaxParallelPerHost)
 
-	client := grab.NewClient()
+	workers := settings.MaxParallelDownloads
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for status := queue.next(); status != nil; status = queue.next() {
+				if retry := downloadAttempt(clients[status.Podcast], status, startedQueue, completedQueue); retry != nil {
+					queue.retry(retry)
+				} else {
+					queue.done(status)
+				}
+			}
+		}()
+	}
 
+	// stop handing out requests, if sync is stopped
+	finished := make(chan struct{})
 	go func() {
-		// wait while all requests will be in queue
-		for i := 0; i < requestCount; i++ {
-			<-doneQueue
+		select {
+		case <-syncStopped:
+			queue.stop()
+		case <-finished:
 		}
-		// close channels
-		close(statusQueue)
-		close(doneQueue)
+	}()
+	// completed queue is closed when workers are done, so progress is not waiting for skipped requests,
+	// last attempts of requests, which were not retried because sync was stopped, are reported as failed
+	go func() {
+		wg.Wait()
+		for _, status := range queue.waitingRetries() {
+			status.RetryIn = 0
+			completedQueue <- status
+		}
+		close(completedQueue)
 	}()
 
-	totalFiles := 0
-	for _, podcastReq := range downloadReqs {
-		totalFiles += len(podcastReq)
+	failed = checkDownloadProgress(startedQueue, completedQueue, totalFiles)
+	wg.Wait()
+	close(finished)
+	skipped = queue.pending()
+	log.Infof("%d files downloaded.\n", totalFiles-len(failed)-len(skipped))
+	return failed, skipped
+}
+
+// downloadClients returns client of each podcast, transfers of all podcasts are limited
+// by global max-bandwidth and transfers of each podcast by its own one
+func downloadClients(downloadReqs []*podcastRequests, settings *GlobalSettings) map[*Podcast]*grab.Client {
+	var globalLimiter *bandwidthLimiter
+	if limit, err := parseBandwidthLimit(settings.MaxBandwidth, settings.BandwidthSchedule); err != nil {
+		log.Warnf("%v, bandwidth is not limited", err)
+	} else if limit.isSet() {
+		globalLimiter = newBandwidthLimiter(limit)
+	}
 
-		go func(requests []*grab.Request) {
-			curPosition := 0
-			podcastTotal := len(requests)
-			for _, req := range requests {
+	clients := make(map[*Podcast]*grab.Client, len(downloadReqs))
+	for _, podcastReq := range downloadReqs {
+		var podcastLimiter *bandwidthLimiter
+		podcast := podcastReq.Podcast
+		if limit, err := parseBandwidthLimit(podcast.MaxBandwidth, podcast.BandwidthSchedule); err != nil {
+			log.Warnf("%s: %v, bandwidth of podcast is not limited", podcast.Name, err)
+		} else if limit.isSet() {
+			podcastLimiter = newBandwidthLimiter(limit)
+		}
+		client := grab.NewClient()
+		client.HTTPClient.Transport = newThrottledTransport(client.HTTPClient.Transport, globalLimiter, podcastLimiter)
+		clients[podcast] = client
+	}
+	return clients
+}
 
-				// increas position, used for printing
-				curPosition++
+// downloadAttempt makes next attempt to download request. Each attempt is reported as separate status,
+// RetryIn is set if attempt will be retried according to retry policy, status to retry is returned then
+func downloadAttempt(client *grab.Client, status *downloadStatus, startedQueue, completedQueue chan<- *downloadStatus) *downloadStatus {
+	attempt := status.Attempt + 1
+	attemptStatus := *status
+	attemptStatus.Attempt = attempt
 
-				// start downloading
-				resp := <-client.DoAsync(req)
+	// resume partially downloaded file if possible
+	if err := preparePartFile(client.HTTPClient, status.Request.Filename, status.Item.Url); err != nil {
+		log.Debug("resume: ", err)
+	}
 
-				// send results to monitoring channel
-				statusQueue <- &downloadStatus{
-					Total:    podcastTotal,
-					Current:  curPosition,
-					Response: resp,
-				}
+	// grab notifies when transfer is completed
+	notify := make(chan *grab.Response, 1)
+	attemptStatus.Request.NotifyOnClose = notify
+
+	// start downloading
+	attemptStatus.StartedAt = time.Now()
+	attemptStatus.Response = <-client.DoAsync(attemptStatus.Request)
+	// validators are saved before transfer, so killed download is resumed only if file is not changed
+	if attemptStatus.Response.HTTPResponse != nil {
+		if err := savePartValidators(status.Request.Filename, status.Item.Url, attemptStatus.Response.HTTPResponse); err != nil {
+			log.Debug("resume: ", err)
+		}
+	}
+	startedQueue <- &attemptStatus
 
-				// ensure files downloaded one by one, so wait complition
-				for !resp.IsComplete() {
-					time.Sleep(500 * time.Microsecond)
-				}
+	// ensure files of podcast downloaded one by one, so wait complition
+	waitComplete(attemptStatus.Response, notify)
+	if attemptStatus.Response.Error == nil {
+		if err := finishPartFile(status.Request.Filename, status.Item.Path); err != nil {
+			attemptStatus.Response.Error = &finalError{err}
+		}
+	}
+	// failed tagging does not fail download
+	if attemptStatus.Response.Error == nil && status.Podcast.Tags != "" {
+		if err := writeItemTags(status.Item, status.Podcast.Tags); err != nil {
+			attemptStatus.Warnings = append(attemptStatus.Warnings, err)
+		}
+	}
+	// failed extras do not fail download too
+	if attemptStatus.Response.Error == nil && len(status.Item.Extras) > 0 {
+		attemptStatus.Warnings = append(attemptStatus.Warnings, downloadExtras(client.HTTPClient, status.Item)...)
+	}
+	if attemptStatus.Response.Error == nil && status.Podcast.OnDownload != "" {
+		if err := runDownloadHook(status.Podcast, status.Item); err != nil {
+			if status.Podcast.HookFailEpisode {
+				// episode is not recorded in history, so it is downloaded again by next sync
+				os.Remove(status.Item.Path)
+				attemptStatus.Response.Error = &finalError{err}
+			} else {
+				attemptStatus.Warnings = append(attemptStatus.Warnings, err)
 			}
+		}
+	}
+
+	if attemptStatus.Response.Error != nil && status.Retry.canRetry(attempt, attemptStatus.Response) {
+		attemptStatus.RetryIn = status.Retry.delay(attempt)
+		completedQueue <- &attemptStatus
+		retry := attemptStatus
+		return &retry
+	}
+	completedQueue <- &attemptStatus
+	return nil
+}
 
-		}(podcastReq)
+// waitComplete blocks until transfer is completed
+func waitComplete(resp *grab.Response, notify <-chan *grab.Response) {
+	// request failed before transfer was started
+	if resp.IsComplete() {
+		return
 	}
-	checkDownloadProgress(statusQueue, totalFiles)
-	log.Infof("%d files downloaded.\n", totalFiles)
+	<-notify
 }
 
 type downloadStatus struct {
-	Total    int // total requests count
-	Current  int // current position
-	Response *grab.Response
+	Total     int // total requests count
+	Current   int // current position
+	Request   *grab.Request
+	Response  *grab.Response
+	Podcast   *Podcast      // podcast, which item belongs to
+	Item      *DownloadItem // item being downloaded
+	History   *History      // podcast history, updated on success
+	Retry     retryPolicy   // podcast retry policy
+	Attempt   int           // current attempt, starts from 1
+	RetryIn   time.Duration // failed attempt will be retried after this delay
+	StartedAt time.Time     // attempt start time
+	Warnings  []error       // non fatal errors of completed download, e.g. tagging
+	queue     *podcastQueue // podcast queue, which request belongs to
+	notBefore time.Time     // failed request is not retried before this time
 }
 
-func checkDownloadProgress(respch <-chan *downloadStatus, reqCount int) {
+// checkDownloadProgress prints progress until all requests are completed, returns failed ones
+func checkDownloadProgress(startedQueue, completedQueue <-chan *downloadStatus, reqCount int) []*downloadStatus {
 	timer := time.NewTicker(200 * time.Millisecond)
 	ui := uilive.New()
 
 	completed := 0
+	finished := map[*downloadStatus]bool{}
 	responses := make([]*downloadStatus, 0)
+	failed := make([]*downloadStatus, 0)
 
-	ui.Start()
+	// progress is printed in text mode only
+	if output.IsText() {
+		ui.Start()
+	}
 	for completed < reqCount {
 		select {
-		case resp := <-respch:
-			if resp != nil {
-				responses = append(responses, resp)
+		case status := <-startedQueue:
+			if !finished[status] {
+				responses = append(responses, status)
 			}
+			output.Emit(newSyncEvent("started", status))
 
-		case <-timer.C:
-			// print completed requests
-			for i, resp := range responses {
-				if resp != nil && resp.Response.IsComplete() {
-
-					if resp.Response.Error != nil {
-						showProgressError(ui, resp)
-					} else {
-						showProgressDone(ui, resp)
+		case status, ok := <-completedQueue:
+			if !ok { // workers are done, rest of requests were skipped
+				completed = reqCount
+				continue
+			}
+			finished[status] = true
+			// print completed request
+			if status.RetryIn > 0 {
+				if output.IsText() {
+					showProgressRetry(ui, status)
+				}
+				output.Emit(newSyncEvent("retry", status))
+				continue
+			}
+			if status.Response.Error != nil {
+				if output.IsText() {
+					showProgressError(ui, status)
+				}
+				output.Emit(newSyncEvent("failed", status))
+				failed = append(failed, status)
+			} else {
+				if output.IsText() {
+					showProgressDone(ui, status)
+					for _, warning := range status.Warnings {
+						fmt.Fprintf(ui.Bypass(), "  %s %s\n", color.YellowString("WARNING:"), warning)
 					}
-
-					responses[i] = nil
-					completed++
+				}
+				output.Emit(newSyncEvent("finished", status))
+				if err := saveToHistory(status); err != nil {
+					log.Warnf("Error saving history for %s: %v", status.Item.Path, err)
 				}
 			}
+			completed++
 
+		case <-timer.C:
 			// print in progress requests
-			for _, resp := range responses {
-				if resp != nil {
-					showProgressProc(ui, resp)
+			inProgress := responses[:0]
+			for _, status := range responses {
+				if !finished[status] {
+					if output.IsText() {
+						showProgressProc(ui, status)
+					}
+					inProgress = append(inProgress, status)
 				}
 			}
+			responses = inProgress
 		}
 	}
 
 	timer.Stop()
-	ui.Stop()
+	if output.IsText() {
+		ui.Stop()
+	}
+	return failed
+}
+
+// printFailureSummary prints downloads, which failed after all attempts
+func printFailureSummary(failed []*downloadStatus) {
+	if len(failed) == 0 {
+		return
+	}
+	log.Warnf("%d files failed:", len(failed))
+	for _, status := range failed {
+		log.Printf("\t* %s : %s", status.Item.Title, status.Item.ItemTitle)
+		log.Printf("\t\t%s", status.Request.URL())
+		log.Printf("\t\t%s (attempts: %d)", color.RedString(status.Response.Error.Error()), status.Attempt)
+	}
+}
+
+// record downloaded item, so it will not be downloaded again
+func saveToHistory(status *downloadStatus) error {
+	status.History.MarkDownloaded(status.Item, status.Item.Path)
+	return status.History.Save()
 }
 
 func bytesToMb(bytesCount uint64) float64 {
 	return float64(bytesCount) / float64(1024*1024)
 }
 
+// attemptInfo returns attempt number for progress line, empty for first attempt
+func attemptInfo(status *downloadStatus) string {
+	if status.Attempt <= 1 {
+		return ""
+	}
+	return fmt.Sprintf(" (attempt %d/%d)", status.Attempt, status.Retry.Count+1)
+}
+
 func showProgressError(ui *uilive.Writer, status *downloadStatus) {
-	fmt.Fprintf(ui.Bypass(), "Error downloading %s: %v\n",
+	fmt.Fprintf(ui.Bypass(), "Error downloading %s%s: %v\n",
 		status.Response.Request.URL(),
+		attemptInfo(status),
 		status.Response.Error)
 }
 
+func showProgressRetry(ui *uilive.Writer, status *downloadStatus) {
+	fmt.Fprintf(ui.Bypass(), "Error downloading %s%s: %v, retry in %s\n",
+		status.Response.Request.URL(),
+		attemptInfo(status),
+		status.Response.Error,
+		status.RetryIn)
+}
+
 func showProgressDone(ui *uilive.Writer, status *downloadStatus) {
 	fmt.Fprintf(ui.Bypass(),
-		"Finished %s [%d/%d] %0.2f / %0.2f Mb (%d%%)\n",
-		status.Response.Filename,
+		"Finished %s [%d/%d]%s %0.2f / %0.2f Mb (%d%%)\n",
+		status.Item.Path,
 		status.Current, status.Total,
+		attemptInfo(status),
 		bytesToMb(status.Response.BytesTransferred()),
 		bytesToMb(status.Response.Size),
 		int(100*status.Response.Progress()))
 }
 
 func showProgressProc(ui *uilive.Writer, status *downloadStatus) {
-	fmt.Fprintf(ui, "Downloading %s [%d/%d] %0.2f / %0.2f Mb (%d%%)\n",
-		status.Response.Filename,
+	fmt.Fprintf(ui, "Downloading %s [%d/%d]%s %0.2f / %0.2f Mb (%d%%)\n",
+		status.Item.Path,
 		status.Current, status.Total,
+		attemptInfo(status),
 		bytesToMb(status.Response.BytesTransferred()),
 		bytesToMb(status.Response.Size),
 		int(100*status.Response.Progress()))
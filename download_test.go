@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestConditionalFeed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Thu, 11 Aug 2016 14:21:57 GMT")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Test</title></channel></rss>`))
+	}))
+	defer ts.Close()
+
+	podcast := &Podcast{Name: "test", Url: ts.URL}
+	_, validators, err := getFeed(podcast, true)
+	if err != nil {
+		t.Fatal("Failed to get feed", err)
+	}
+	assert.Equal(t, `"v1"`, validators.ETag)
+	assert.Equal(t, "Thu, 11 Aug 2016 14:21:57 GMT", validators.LastModified)
+
+	podcast.FeedETag = validators.ETag
+	_, _, err = getFeed(podcast, true)
+	assert.Equal(t, ErrFeedNotModified, err)
+
+	_, _, err = getFeed(podcast, false)
+	assert.Nil(t, err, "unconditional request should download feed")
+}
+
+func TestDryRunSync(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testdryrun")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Show</title>
+<item><title>One</title><guid>1</guid><enclosure url="http://host/a/ep.mp3" length="2048" type="audio/mpeg"/></item>
+<item><title>Two</title><guid>2</guid><enclosure url="http://host/b/ep.mp3" length="0" type="audio/mpeg"/></item>
+<item><title>Three</title><guid>3</guid><enclosure url="http://host/old.mp3" length="1" type="audio/mpeg"/></item>
+</channel></rss>`))
+	}))
+	defer ts.Close()
+
+	// feed is not changed since last sync
+	content := "download-path = " + tmpDir + "\ncache-path = " + tmpDir + "\nseparate-dir = {{Name}}\n\n[show]\nurl = " + ts.URL + "\nfeed-etag = `\"v1\"`\n"
+	cfgPath := filepath.Join(tmpDir, "config.ini")
+	ioutil.WriteFile(cfgPath, []byte(content), 0666)
+	savedCfg := cfg
+	defer func() { cfg = savedCfg }()
+	if cfg, err = NewConfig(cfgPath); err != nil {
+		t.Fatal("Failed to read config", err)
+	}
+	podcast, _ := cfg.GetPodcastByName("show")
+	history, _ := LoadHistory(cfg.HistoryPath(podcast))
+	history.MarkDownloaded(&DownloadItem{Guid: "3", Url: "http://host/old.mp3"}, filepath.Join(tmpDir, "old.mp3"))
+	history.Save()
+	historyContent, _ := ioutil.ReadFile(cfg.HistoryPath(podcast))
+
+	buf := &bytes.Buffer{}
+	savedOutput := output
+	output, _ = NewOutput(outputJSON, buf)
+	defer func() { output = savedOutput }()
+
+	if err := syncPodcasts(time.Time{}, "", -1, false, true); err != nil {
+		t.Fatal("Dry run failed", err)
+	}
+	output.Flush()
+
+	records := []*checkRecord{}
+	if !assert.NoError(t, json.Unmarshal(buf.Bytes(), &records)) || !assert.Len(t, records, 1) {
+		return
+	}
+	paths := []string{}
+	for _, item := range records[0].Items {
+		paths = append(paths, item.Path)
+	}
+	assert.Equal(t, []string{filepath.Join(tmpDir, "show", "ep.mp3"), filepath.Join(tmpDir, "show", "ep (2).mp3")}, paths)
+	assert.Equal(t, int64(2048), records[0].Items[0].Size)
+	assert.Equal(t, "http://host/a/ep.mp3", records[0].Items[0].Url)
+
+	// nothing is changed
+	assert.False(t, fileExists(filepath.Join(tmpDir, "show")), "dir should not be created")
+	newContent, _ := ioutil.ReadFile(cfgPath)
+	assert.Equal(t, content, string(newContent))
+	newHistoryContent, _ := ioutil.ReadFile(cfg.HistoryPath(podcast))
+	assert.Equal(t, string(historyContent), string(newHistoryContent))
+}
+
+func TestCreateRequestsSkipsFailedDir(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testcreaterequests")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	// dir of first item cannot be created, because file with same name exists
+	ioutil.WriteFile(filepath.Join(tmpDir, "blocked"), []byte("x"), 0666)
+	podcast := &Podcast{Name: "test"}
+	podcast.DownloadPath = tmpDir
+	items := []*DownloadItem{
+		{Dir: "blocked", Filename: "a.mp3", Url: "http://host/a.mp3"},
+		{Dir: "ok", Filename: "b.mp3", Url: "http://host/b.mp3"},
+	}
+
+	reqs := createRequests(podcast, nil, items, map[string]bool{})
+	if assert.Len(t, reqs.Items, 1, "item with failed dir should be skipped") {
+		assert.Equal(t, "http://host/b.mp3", reqs.Items[0].Url)
+		assert.Len(t, reqs.Requests, 1)
+	}
+	assert.True(t, fileExists(filepath.Join(tmpDir, "ok")))
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -13,425 +14,588 @@ import (
 /// Expression
 /////////////////////////////////////////////////////////////////////
 
+// filterNode is node of compiled filter
+type filterNode interface {
+	eval(data map[string]string) (bool, error)
+}
+
+// orNode is true if any of nodes is true
+type orNode []filterNode
+
+// andNode is true if all nodes are true
+type andNode []filterNode
+
+// notNode reverts value of node: not (...)
+type notNode struct {
+	node filterNode
+}
+
+// operand is string or variable of expression
+type operand struct {
+	value    string
+	variable bool // value is variable name
+	pos      int  // position in filter
+}
+
+// Expression is condition of filter, e.g. 'text' not icase in {{var}}
 type Expression struct {
-	lText     string            // text to search
-	rText     string            // text where to search
-	prefix    bool              // search like '%str'
-	suffix    bool              // search like 'str%'
-	not       bool              // revers value
-	in        bool              // just for syntax check
-	completed bool              // epression has all data
-	result    bool              // current result
-	data      map[string]string // data replace variable
-}
-
-// evaluate completed expression
-func (e *Expression) Evaluate() error {
-	res := false
-	if !e.completed || !e.in {
-		return errors.New("malformed expression: one of the argument is missing")
-	}
-	if e.prefix {
-		res = strings.HasPrefix(e.rText, e.lText)
-	} else if e.suffix {
-		res = strings.HasSuffix(e.rText, e.lText)
-	} else {
-		res = strings.Contains(e.rText, e.lText)
-	}
-	if e.not {
-		res = !res
-	}
-	e.result = res
-	e.Reset() // result saved, no need other values
-	return nil
+	left, right operand
+	op          string         // in, matches, =, !=, <, <=, >, >=
+	prefix      bool           // search like '%str'
+	suffix      bool           // search like 'str%'
+	not         bool           // revers value
+	icase       bool           // case insensitive search or comparison
+	pattern     *regexp.Regexp // compiled right string of matches, nil if right is variable
 }
 
-// add left or rigt string
-func (e *Expression) AddString(s string) error {
-	if e.lText == "" {
-		e.lText = s
-	} else if e.rText == "" {
-		e.rText = s
-		e.completed = true
-	} else {
-		return errors.New("malformed expression: too many input arguments")
+func (n orNode) eval(data map[string]string) (bool, error) {
+	for _, node := range n {
+		if ok, err := node.eval(data); err != nil || ok {
+			return ok, err
+		}
 	}
-	return nil
+	return false, nil
 }
 
-func (e *Expression) AddVariable(s string) error {
-	if val, ok := e.data[s]; !ok {
-		return errors.New("Variable " + s + " was not found in provided data")
-	} else {
-		if err := e.AddString(val); err != nil {
-			return err
+func (n andNode) eval(data map[string]string) (bool, error) {
+	for _, node := range n {
+		if ok, err := node.eval(data); err != nil || !ok {
+			return false, err
 		}
 	}
-	return nil
+	return true, nil
 }
 
-func (e *Expression) AddKeyword(k string) error {
-	switch k {
+func (n *notNode) eval(data map[string]string) (bool, error) {
+	ok, err := n.node.eval(data)
+	return !ok, err
+}
+
+// get returns string or value of variable
+func (o *operand) get(data map[string]string) (string, error) {
+	if !o.variable {
+		return o.value, nil
+	}
+	if val, ok := data[o.value]; ok {
+		return val, nil
+	}
+	return "", &FilterError{Msg: "Variable " + o.value + " was not found in provided data", Pos: o.pos}
+}
+
+// eval evaluates expression with item data
+func (e *Expression) eval(data map[string]string) (bool, error) {
+	lText, err := e.left.get(data)
+	if err != nil {
+		return false, err
+	}
+	rText, err := e.right.get(data)
+	if err != nil {
+		return false, err
+	}
+
+	res := false
+	switch e.op {
+	case "matches":
+		pattern := e.pattern
+		if pattern == nil {
+			if pattern, err = compilePattern(rText, e.icase, e.right.pos); err != nil {
+				return false, err
+			}
+		}
+		res = pattern.MatchString(lText)
 	case "in":
-		if !e.in && e.lText != "" && e.rText == "" {
-			e.in = true
-		} else {
-			return errors.New("malformed expression: " + k)
+		if e.icase {
+			lText, rText = foldString(lText), foldString(rText)
 		}
-	case "not":
-		if !e.not && !e.in && e.lText != "" {
-			e.not = true
+		if e.prefix {
+			res = strings.HasPrefix(rText, lText)
+		} else if e.suffix {
+			res = strings.HasSuffix(rText, lText)
 		} else {
-			return errors.New("malformed expression: " + k)
+			res = strings.Contains(rText, lText)
 		}
-	case "prefix":
-		if !e.prefix && e.in && e.lText != "" && e.rText == "" {
-			e.prefix = true
-		} else {
-			return errors.New("malformed expression: " + k)
+	default:
+		if e.icase {
+			lText, rText = foldString(lText), foldString(rText)
 		}
-	case "suffix":
-		if !e.suffix && e.in && e.lText != "" && e.rText == "" {
-			e.suffix = true
-		} else {
-			return errors.New("malformed expression: " + k)
+		res = compareValues(lText, rText, e.op)
+	}
+	if e.not {
+		res = !res
+	}
+	return res, nil
+}
+
+// compilePattern compiles regular expression of matches
+func compilePattern(s string, icase bool, pos int) (*regexp.Regexp, error) {
+	expr := s
+	if icase {
+		expr = "(?i)" + s
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, &FilterError{Msg: fmt.Sprintf("invalid pattern '%s': %s", s, err), Pos: pos}
+	}
+	return re, nil
+}
+
+// compareValues compares values by operator, values are compared as numbers, durations
+// or dates, if both can be parsed as such, strings are compared otherwise.
+// Empty value is not less or greater than other value
+func compareValues(l, r, op string) bool {
+	if (l == "" || r == "") && op != "=" && op != "!=" {
+		return false
+	}
+	var cmp int
+	if lNum, rNum, ok := parseNumbers(l, r); ok {
+		cmp = compareFloats(lNum, rNum)
+	} else if lDur, rDur, ok := parseDurations(l, r); ok {
+		cmp = compareFloats(float64(lDur), float64(rDur))
+	} else if lTime, rTime, ok := parseTimes(l, r); ok {
+		cmp = compareFloats(float64(lTime.Unix()), float64(rTime.Unix()))
+	} else {
+		cmp = strings.Compare(l, r)
+	}
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func compareFloats(l, r float64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func parseNumbers(l, r string) (float64, float64, bool) {
+	lNum, lErr := strconv.ParseFloat(strings.TrimSpace(l), 64)
+	rNum, rErr := strconv.ParseFloat(strings.TrimSpace(r), 64)
+	return lNum, rNum, lErr == nil && rErr == nil
+}
+
+// parseDurations parses Go durations, plain numbers are seconds, e.g. '{{ItemDuration}} > 10m'
+func parseDurations(l, r string) (time.Duration, time.Duration, bool) {
+	parse := func(s string) (time.Duration, error) {
+		s = strings.TrimSpace(s)
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return time.Duration(n * float64(time.Second)), nil
 		}
-	default:
-		return errors.New("malformed expression: uknown keyword: " + k)
+		return time.ParseDuration(s)
 	}
-	return nil
+	lDur, lErr := parse(l)
+	rDur, rErr := parse(r)
+	return lDur, rDur, lErr == nil && rErr == nil
+}
+
+func parseTimes(l, r string) (time.Time, time.Time, bool) {
+	lTime, lErr := parseTime(l)
+	rTime, rErr := parseTime(r)
+	return lTime, rTime, lErr == nil && rErr == nil
 }
 
-// reset experssion data to default
-func (e *Expression) Reset() {
-	e.lText = ""
-	e.rText = ""
-	e.prefix = false
-	e.suffix = false
-	e.not = false
-	e.in = false
-	e.completed = false
+// foldString replaces each rune by the smallest rune of its Unicode case folding orbit,
+// so strings which are equal under case folding become equal
+func foldString(s string) string {
+	return strings.Map(func(r rune) rune {
+		min := r
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f < min {
+				min = f
+			}
+		}
+		return min
+	}, s)
 }
 
 /////////////////////////////////////////////////////////////////////
 /// Lexer
 /////////////////////////////////////////////////////////////////////
 
-type itemType int
+type tokenType int
 
 const (
-	itemExpr itemType = iota
-	itemEOF
-	itemError
-	itemKeyword
-	itemOpenBlock  // (
-	itemCloseBlock // )
-	itemAnd        // "and" keyword
-	itemOr         // "or"  keyword
+	tokenEOF        tokenType = iota
+	tokenString               // 'text' or "text"
+	tokenLiteral              // unquoted number, duration or date: 600, 10m, 2024-01-01
+	tokenVariable             // {{var}}
+	tokenKeyword              // in, not, and, ...
+	tokenOperator             // =, !=, <, <=, >, >=
+	tokenOpenBlock            // (
+	tokenCloseBlock           // )
 )
 
-const eof = -1
-
-type item struct {
-	typ itemType
-	err string
-	val bool
+type token struct {
+	typ tokenType
+	val string
+	pos int // position in input, start of value for strings and variables
 }
 
-type stateFn func(*lexer) stateFn
+// FilterError is syntax error of filter at position (byte offset) in filter
+type FilterError struct {
+	Msg string
+	Pos int
+}
 
-// lexer holds the state of the scanner.
-type lexer struct {
-	input      string     // the string being scanned.
-	start      int        // start position of this item.
-	pos        int        // current position in the input.
-	width      int        // width of last rune read from input.
-	items      chan item  // channel of scanned items.
-	parenDepth int        // nesting depth of ( )
-	expression Expression // hold current expression
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%s, pos : %d", e.Msg, e.Pos)
 }
 
-func lex(input string, data map[string]string) *lexer {
-	l := &lexer{
-		input:      input,
-		items:      make(chan item),
-		expression: Expression{data: data},
-	}
-	go l.run() // Concurrently run state machine.
-	return l
+var filterKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "icase": true,
+	"in": true, "prefix": true, "suffix": true, "matches": true,
 }
 
-func (l *lexer) nextItem() item {
-	item := <-l.items
-	return item
+func isAlphaNumeric(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
-// error returns an error token and terminates the scan
-// by passing back a nil pointer that will be the next
-// state, terminating l.run.
-func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{
-		typ: itemError,
-		err: fmt.Sprintf(format, args...) + fmt.Sprintf(", pos : %d", l.pos),
-	}
-	return nil
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
 }
 
-func (l *lexer) emit(t itemType, s stateFn) stateFn {
-	switch {
-	case t > itemKeyword || t == itemEOF:
-		l.items <- item{typ: t}
-	case t == itemExpr:
-		if l.expression.completed {
-			if err := l.expression.Evaluate(); err != nil {
-				return l.errorf("%s", err)
-			} else {
-				l.items <- item{val: l.expression.result}
-				l.expression.Reset()
+// scanFilter splits filter to tokens, last token is tokenEOF
+func scanFilter(input string) ([]token, error) {
+	tokens := []token{}
+	for pos := 0; pos < len(input); {
+		r, width := utf8.DecodeRuneInString(input[pos:])
+		switch {
+		case isSpace(r):
+			pos += width
+
+		case r == '\'' || r == '"':
+			end := strings.IndexRune(input[pos+1:], r)
+			if end < 0 {
+				return nil, &FilterError{Msg: "unterminated quoted string", Pos: pos}
+			}
+			tokens = append(tokens, token{typ: tokenString, val: input[pos+1 : pos+1+end], pos: pos + 1})
+			pos += end + 2
+
+		case strings.HasPrefix(input[pos:], "{{"):
+			end := strings.Index(input[pos:], "}}")
+			if end < 0 {
+				return nil, &FilterError{Msg: "unclosed variable", Pos: pos}
+			}
+			name := input[pos+2 : pos+end]
+			if name == "" {
+				return nil, &FilterError{Msg: "variable name cannot be empty", Pos: pos}
+			}
+			for _, c := range name {
+				if !isAlphaNumeric(c) {
+					return nil, &FilterError{Msg: "invalid variable name: " + name, Pos: pos + 2}
+				}
 			}
+			tokens = append(tokens, token{typ: tokenVariable, val: name, pos: pos + 2})
+			pos += end + 2
+
+		case unicode.IsDigit(r):
+			end := pos
+			for end < len(input) {
+				c, w := utf8.DecodeRuneInString(input[end:])
+				if isSpace(c) || strings.ContainsRune("()=!<>'\"", c) {
+					break
+				}
+				end += w
+			}
+			tokens = append(tokens, token{typ: tokenLiteral, val: input[pos:end], pos: pos})
+			pos = end
+
+		case isAlphaNumeric(r):
+			end := pos
+			for end < len(input) {
+				c, w := utf8.DecodeRuneInString(input[end:])
+				if !isAlphaNumeric(c) {
+					break
+				}
+				end += w
+			}
+			word := input[pos:end]
+			if !filterKeywords[word] {
+				return nil, &FilterError{Msg: "malformed expression: uknown keyword: " + word, Pos: pos}
+			}
+			tokens = append(tokens, token{typ: tokenKeyword, val: word, pos: pos})
+			pos = end
+
+		case strings.ContainsRune("=!<>", r):
+			end := pos + 1
+			if end < len(input) && input[end] == '=' {
+				end++
+			}
+			switch op := input[pos:end]; op {
+			case "=", "!=", "<", "<=", ">", ">=":
+				tokens = append(tokens, token{typ: tokenOperator, val: op, pos: pos})
+			default:
+				return nil, &FilterError{Msg: "malformed expression: unknown operator: " + op, Pos: pos}
+			}
+			pos = end
+
+		case r == '(':
+			tokens = append(tokens, token{typ: tokenOpenBlock, val: "(", pos: pos})
+			pos += width
+
+		case r == ')':
+			tokens = append(tokens, token{typ: tokenCloseBlock, val: ")", pos: pos})
+			pos += width
+
+		default:
+			return nil, &FilterError{Msg: fmt.Sprintf("unrecognized character: %#U", r), Pos: pos}
 		}
 	}
-	l.start = l.pos
-	return s
+	return append(tokens, token{typ: tokenEOF, pos: len(input)}), nil
 }
 
-// next returns the next rune in the input.
-func (l *lexer) next() rune {
-	if int(l.pos) >= len(l.input) {
-		l.width = 0
-		return eof
-	}
-	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
-	l.width = w
-	l.pos += l.width
-	return r
-}
+/////////////////////////////////////////////////////////////////////
+/// Parser
+/////////////////////////////////////////////////////////////////////
 
-// ignore skips over the pending input before this point.
-func (l *lexer) ignore() {
-	l.start = l.pos
+// parser builds filter tree, 'and' has higher precedence than 'or':
+//
+//	or    := and { 'or' and }
+//	and   := unary { 'and' unary }
+//	unary := 'not' '(' or ')' | '(' or ')' | expression
+//	expression := operand { 'not' | 'icase' } op operand
+//	op    := 'in' [ 'prefix' | 'suffix' ] | 'matches' | '=' | '!=' | '<' | '<=' | '>' | '>='
+type parser struct {
+	tokens    []token
+	pos       int
+	foldCase  bool                      // all expressions are case insensitive
+	patterns  map[string]*regexp.Regexp // compiled patterns, same patterns are compiled once
+	variables []*operand
 }
 
-// get current rune
-func (l *lexer) current() rune {
-	r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
-	return r
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
 }
 
-// backup steps back one rune.
-// Can be called only once per call of next.
-func (l *lexer) backup() {
-	l.pos -= l.width
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
 }
 
-// peek returns but does not consume
-// the next rune in the input.
-func (l *lexer) peek() rune {
-	r := l.next()
-	l.backup()
-	return r
+func (p *parser) isKeyword(word string) bool {
+	t := p.peek()
+	return t.typ == tokenKeyword && t.val == word
 }
 
-// accept consumes the next rune
-// if it's from the valid set.
-func (l *lexer) accept(valid string) bool {
-	if strings.IndexRune(valid, l.next()) >= 0 {
-		return true
+func malformed(t token) error {
+	if t.typ == tokenEOF {
+		return &FilterError{Msg: "malformed expression: one of the argument is missing", Pos: t.pos}
 	}
-	l.backup()
-	return false
+	return &FilterError{Msg: "malformed expression: " + t.val, Pos: t.pos}
 }
 
-func isEndOfLine(r rune) bool {
-	return r == '\r' || r == '\n'
+func (p *parser) parseOr() (filterNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := orNode{node}
+	for p.isKeyword("or") {
+		p.next()
+		if node, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
 }
 
-func isAlphaNumeric(r rune) bool {
-	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+func (p *parser) parseAnd() (filterNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := andNode{node}
+	for p.isKeyword("and") {
+		p.next()
+		if node, err = p.parseUnary(); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
 }
 
-func isSpace(r rune) bool {
-	return r == ' ' || r == '\t'
+func (p *parser) parseUnary() (filterNode, error) {
+	if p.isKeyword("not") {
+		t := p.next()
+		if p.peek().typ != tokenOpenBlock {
+			return nil, malformed(t)
+		}
+		node, err := p.parseBlock()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node: node}, nil
+	}
+	if p.peek().typ == tokenOpenBlock {
+		return p.parseBlock()
+	}
+	return p.parseExpression()
 }
 
-func (l *lexer) run() {
-	for state := lexExpr; state != nil; {
-		state = state(l)
+func (p *parser) parseBlock() (filterNode, error) {
+	open := p.next()
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
 	}
-	close(l.items) // No more tokens will be delivered.
+	if p.peek().typ != tokenCloseBlock {
+		return nil, &FilterError{Msg: "unclosed left paren", Pos: open.pos}
+	}
+	p.next()
+	return node, nil
 }
 
-func (l *lexer) getVal() string {
-	return l.input[l.start:l.pos]
+func (p *parser) parseOperand() (operand, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenString, tokenLiteral:
+		return operand{value: t.val, pos: t.pos}, nil
+	case tokenVariable:
+		o := operand{value: t.val, variable: true, pos: t.pos}
+		p.variables = append(p.variables, &o)
+		return o, nil
+	}
+	return operand{}, malformed(t)
 }
 
-func lexExpr(l *lexer) stateFn {
-	for {
-		switch r := l.next(); {
-		case isSpace(r): // ignore spaces
-			l.ignore()
-			continue
-
-		case r == eof || isEndOfLine(r): // exit condition
-			if l.parenDepth != 0 {
-				return l.errorf("unclosed left paren")
-			}
-			return l.emit(itemEOF, nil)
-
-		case r == '\'' || r == '"': // handle single and double quotes
-			l.backup()
-			return lexQuote
-
-		case r == '{':
-			if tmp := l.next(); tmp == '{' { // handle vars: {{var}}
-				return lexVariable
-			} else {
-				return l.errorf("unrecognized character: %#U", r)
-			}
-
-		case isAlphaNumeric(r): // handle any kywords, order will be checked later
-			return lexKeyword
-		case r == '(':
-			l.parenDepth++
-			return l.emit(itemOpenBlock, lexExpr)
+func (p *parser) parseExpression() (filterNode, error) {
+	e := &Expression{icase: p.foldCase}
+	var err error
+	if e.left, err = p.parseOperand(); err != nil {
+		return nil, err
+	}
 
-		case r == ')':
-			l.parenDepth--
-			if l.parenDepth < 0 {
-				return l.errorf("unexpected right paren %#U", r)
-			}
-			return l.emit(itemCloseBlock, lexExpr)
-		default:
-			return l.errorf("unrecognized character: %#U", r)
+	// modifiers
+	icase := false
+	for p.isKeyword("not") || p.isKeyword("icase") {
+		t := p.next()
+		if (t.val == "not" && e.not) || (t.val == "icase" && icase) {
+			return nil, malformed(t)
+		}
+		if t.val == "not" {
+			e.not = true
+		} else {
+			icase = true
+			e.icase = true
 		}
 	}
-	return l.emit(itemEOF, nil)
-}
-
-func lexQuote(l *lexer) stateFn {
-	curQuote := l.current() // take current rune to find it's pair
-	l.pos += 1              // ignore left quote
-	l.ignore()
-	for {
-		switch r := l.next(); {
-		case isEndOfLine(r):
-			return l.errorf("unterminated quoted string")
-		case r == curQuote:
-			l.backup() // exclude right quote
-			if err := l.expression.AddString(l.getVal()); err != nil {
-				return l.errorf("%s", err)
-			}
-			l.next() // ignore right quote
-			//l.pos += 1
-			l.ignore()
-			return l.emit(itemExpr, lexExpr)
+
+	// operator
+	t := p.next()
+	switch {
+	case t.typ == tokenKeyword && t.val == "in":
+		e.op = t.val
+		if p.isKeyword("prefix") || p.isKeyword("suffix") {
+			e.prefix = p.isKeyword("prefix")
+			e.suffix = !e.prefix
+			p.next()
 		}
+	case t.typ == tokenKeyword && t.val == "matches", t.typ == tokenOperator:
+		e.op = t.val
+	case t.typ == tokenEOF:
+		return nil, malformed(t)
+	case t.typ == tokenString || t.typ == tokenLiteral || t.typ == tokenVariable:
+		return nil, &FilterError{Msg: "malformed expression: operator is missing", Pos: t.pos}
+	default:
+		return nil, malformed(t)
 	}
-	return nil
-}
 
-func lexVariable(l *lexer) stateFn {
-	l.ignore() // ignore left braket {{
-	for {
-		switch r := l.next(); {
-		case r == '}':
-			if tmp := l.next(); tmp == '}' {
-				if l.start == l.pos {
-					return l.errorf("variable name cannot be empty")
-				}
-				l.pos -= 2 // exclude right }}
-				if err := l.expression.AddVariable(l.getVal()); err != nil {
-					return l.errorf("%s", err)
-				}
-				l.pos += 2
-				l.ignore() // ignore right }}
-				return l.emit(itemExpr, lexExpr)
-			}
-		case isAlphaNumeric(r):
-			// absorb.
-		case isEndOfLine(r):
-			return l.errorf("unexpected EOL")
-		default:
-			return l.errorf("unclosed left paren")
+	if e.right, err = p.parseOperand(); err != nil {
+		return nil, err
+	}
+	if e.op == "matches" && !e.right.variable {
+		if e.pattern, err = p.compile(e.right.value, e.icase, e.right.pos); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	return e, nil
 }
 
-func lexKeyword(l *lexer) stateFn {
-	for { // TODO move braces here
-		switch r := l.next(); {
-		case !isAlphaNumeric(r): // consume all alphanumeric
-			l.backup()
-			w := l.getVal()
-			switch w {
-			case "and":
-				return l.emit(itemAnd, lexExpr)
-			case "or":
-				return l.emit(itemOr, lexExpr)
-			default:
-				if err := l.expression.AddKeyword(w); err != nil {
-					return l.errorf("%s", err)
-				}
-				return l.emit(itemExpr, lexExpr)
-			}
-		}
+// compile compiles pattern, same patterns are compiled once
+func (p *parser) compile(s string, icase bool, pos int) (*regexp.Regexp, error) {
+	key := strconv.FormatBool(icase) + s
+	if re, ok := p.patterns[key]; ok {
+		return re, nil
 	}
-	return nil
+	re, err := compilePattern(s, icase, pos)
+	if err != nil {
+		return nil, err
+	}
+	p.patterns[key] = re
+	return re, nil
 }
 
 /////////////////////////////////////////////////////////////////////
 /// Main
 /////////////////////////////////////////////////////////////////////
 
-// Evaluate filter and return boolean result
+// CompiledFilter is filter parsed once and evaluated for each item
+type CompiledFilter struct {
+	root      filterNode
+	variables []*operand // all variables, used for checks
+}
+
+// CompileFilter parses filter, if foldCase is set, all expressions are case insensitive
 // filter example : "SOMETEXT" in {{token}}
-func processFilter(l *lexer) (bool, error) {
-	result := false
-L:
-	for {
-		item := l.nextItem()
-		switch item.typ {
-		case itemEOF:
-			break L
-		case itemError:
-			return false, errors.New(item.err)
-
-		case itemExpr:
-			result = item.val
-
-		case itemAnd, itemOr:
-			nextResult := l.nextItem()
-			var v bool
-			switch nextResult.typ {
-			case itemExpr:
-				v = nextResult.val
-			case itemOpenBlock:
-				if tmp, err := processFilter(l); err != nil {
-					return false, err
-				} else {
-					v = tmp
-				}
-			case itemError:
-				return false, errors.New(item.err)
-			}
-			if item.typ == itemAnd {
-				result = result && v
-			} else {
-				result = result || v
-			}
+func CompileFilter(s string, foldCase bool) (*CompiledFilter, error) {
+	tokens, err := scanFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, foldCase: foldCase, patterns: map[string]*regexp.Regexp{}}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	switch t := p.peek(); t.typ {
+	case tokenEOF:
+	case tokenCloseBlock:
+		return nil, &FilterError{Msg: fmt.Sprintf("unexpected right paren %#U", ')'), Pos: t.pos}
+	default:
+		return nil, malformed(t)
+	}
+	return &CompiledFilter{root: root, variables: p.variables}, nil
+}
 
-		case itemOpenBlock:
-			if tmp, err := processFilter(l); err != nil {
-				return false, err
-			} else {
-				result = tmp
-			}
-		case itemCloseBlock:
-			break L
+// Eval evaluates filter with item data
+func (f *CompiledFilter) Eval(data map[string]string) (bool, error) {
+	return f.root.eval(data)
+}
+
+// CheckVariables returns error for first variable, which is missing in data
+func (f *CompiledFilter) CheckVariables(data map[string]string) error {
+	for _, v := range f.variables {
+		if _, err := v.get(data); err != nil {
+			return err
 		}
 	}
-	return result, nil
+	return nil
 }
 
 // replace tokens in string, token names are keys in data map
@@ -448,7 +612,16 @@ func EvalFormat(s string, data map[string]string) string {
 	return res
 }
 
+// EvalFilter compiles and evaluates filter
 func EvalFilter(s string, data map[string]string) (bool, error) {
-	l := lex(s, data)
-	return processFilter(l)
+	return evalFilter(s, data, false)
+}
+
+// evalFilter same as EvalFilter, if foldCase is set, all expressions are case insensitive
+func evalFilter(s string, data map[string]string, foldCase bool) (bool, error) {
+	f, err := CompileFilter(s, foldCase)
+	if err != nil {
+		return false, err
+	}
+	return f.Eval(data)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -12,6 +13,11 @@ var condData = map[string]string{
 	"second":  "second is description",
 	"third":   "third is description",
 	"unicode": "Кремов и Хрусталев @ Radio Record #1448",
+	"type":    "trailer",
+	"length":  "3723",
+	"size":    "52428800",
+	"date":    "2024-01-15",
+	"empty":   "",
 }
 
 var condTests = []struct {
@@ -67,6 +73,138 @@ var condTests = []struct {
 		in:  "'Текст' in {{unicode}}",
 		out: false,
 	},
+	{
+		in:  "{{unicode}} matches '#[0-9]+$'",
+		out: true,
+	},
+	{
+		in:  "{{title}} matches '^[0-9]+'",
+		out: false,
+	},
+	{
+		in:  "{{title}} not matches '^[0-9]+' and 'OTHER' in {{descr}}",
+		out: true,
+	},
+	{
+		in:  "'Хрусталев' in {{unicode}} and {{unicode}} matches 'Radio\\s+Record'",
+		out: true,
+	},
+	{
+		in:  "'some' in {{title}}",
+		out: false,
+	},
+	{
+		in:  "'some' icase in {{title}}",
+		out: true,
+	},
+	{
+		in:  "'some' icase in prefix {{title}}",
+		out: true,
+	},
+	{
+		in:  "'TITILE' icase in suffix {{title}}",
+		out: true,
+	},
+	{
+		in:  "'some' not icase in {{title}}",
+		out: false,
+	},
+	{
+		in:  "'some' icase not in {{title}}",
+		out: false,
+	},
+	{
+		in:  "'кРЕМОВ И хрусталев' icase in {{unicode}}",
+		out: true,
+	},
+	{
+		in:  "{{unicode}} icase matches '^кремов.*radio record'",
+		out: true,
+	},
+	{
+		in:  "{{type}} = 'trailer'",
+		out: true,
+	},
+	{
+		in:  "{{type}} != 'trailer'",
+		out: false,
+	},
+	{
+		in:  "{{type}} = 'TRAILER'",
+		out: false,
+	},
+	{
+		in:  "{{type}} icase = 'TRAILER'",
+		out: true,
+	},
+	{
+		in:  "{{length}} > 600",
+		out: true,
+	},
+	{
+		in:  "{{length}} <= 600 or {{size}}>=52428800",
+		out: true,
+	},
+	{
+		in:  "{{length}} > 1h and {{length}} < 1h30m",
+		out: true,
+	},
+	{
+		in:  "{{length}} >= '90m'",
+		out: false,
+	},
+	{
+		in:  "{{date}} >= '2024-01-01'",
+		out: true,
+	},
+	{
+		in:  "{{date}} < 20240115",
+		out: false,
+	},
+	{
+		in:  "{{date}} > 2024/1/10 and 'trailer' not in {{type}}",
+		out: false,
+	},
+	{
+		in:  "{{empty}} < 600",
+		out: false,
+	},
+	{
+		in:  "{{empty}} > 600",
+		out: false,
+	},
+	{
+		in:  "{{empty}} = ''",
+		out: true,
+	},
+	{
+		in:  "{{empty}} not = ''",
+		out: false,
+	},
+	{
+		in:  "'SOME' in {{title}} or 'first' in {{second}} and 'third' in {{third}}",
+		out: true,
+	},
+	{
+		in:  "'first' in {{second}} and 'third' in {{third}} or 'SOME' in {{title}}",
+		out: true,
+	},
+	{
+		in:  "('SOME' in {{title}} or 'first' in {{second}}) and 'third' in {{second}}",
+		out: false,
+	},
+	{
+		in:  "not ('SOME' in {{title}})",
+		out: false,
+	},
+	{
+		in:  "not ('x' in {{title}} or 'y' in {{title}}) and 'OTHER' in {{descr}}",
+		out: true,
+	},
+	{
+		in:  "not (not ({{length}} > 600))",
+		out: true,
+	},
 }
 
 var condFailTest = []struct {
@@ -87,6 +225,60 @@ var condFailTest = []struct {
 	{
 		in: "not 'SOME' in {{title}}",
 	},
+	{
+		in: "{{title}} matches '(SOME'",
+	},
+	{
+		in: "{{title}} matches in 'SOME'",
+	},
+	{
+		in: "'SOME' in matches {{title}}",
+	},
+	{
+		in: "'SOME' in icase {{title}}",
+	},
+	{
+		in: "'SOME' icase icase in {{title}}",
+	},
+	{
+		in: "{{length}} == 600",
+	},
+	{
+		in: "{{length}} ! 600",
+	},
+	{
+		in: "{{length}} > < 600",
+	},
+	{
+		in: "{{length}} in > 600",
+	},
+	{
+		in: "> 600",
+	},
+	{
+		in: "{{length}} 600",
+	},
+	{
+		in: "not",
+	},
+	{
+		in: "'SOME' in {{title}} and",
+	},
+	{
+		in: "()",
+	},
+	{
+		in: "'SOME' in {{title}} 'x'",
+	},
+	{
+		in: "'SOME' in {{title}} or or 'x' in {{title}}",
+	},
+	{
+		in: "'SOME' in {{unknown}}",
+	},
+	{
+		in: "'SOME' in {{title",
+	},
 }
 
 var formatData = map[string]string{
@@ -150,6 +342,48 @@ func TestFailCond(t *testing.T) {
 	}
 }
 
+func TestFoldCase(t *testing.T) {
+	for i, test := range []struct {
+		in  string
+		out bool
+	}{
+		{in: "'some' in {{title}}", out: true},
+		{in: "'хрусталев @ RADIO' in {{unicode}}", out: true},
+		{in: "{{descr}} matches '^other'", out: true},
+		{in: "'other' not in {{descr}}", out: false},
+	} {
+		r, err := evalFilter(test.in, condData, true)
+		if err != nil {
+			t.Error("Parse template failed :", err)
+			continue
+		}
+		if r != test.out {
+			t.Error("t:", i, "expected :", test.out, "got :", r)
+		}
+	}
+}
+
+func TestPatternCache(t *testing.T) {
+	f, err := CompileFilter("{{title}} matches 'SOME' or {{descr}} matches 'SOME'", false)
+	if err != nil {
+		t.Fatal("Parse template failed :", err)
+	}
+	nodes := f.root.(orNode)
+	if nodes[0].(*Expression).pattern != nodes[1].(*Expression).pattern {
+		t.Error("expected one compiled pattern")
+	}
+	for i := 0; i < 2; i++ {
+		if ok, err := f.Eval(condData); err != nil || !ok {
+			t.Error("expected true, got :", ok, err)
+		}
+	}
+
+	_, err = EvalFilter("'SOME' in {{title}} and {{title}} matches '(SOME'", condData)
+	if err == nil || !strings.HasSuffix(err.Error(), "pos : 43") {
+		t.Error("expected error at pattern position, got :", err)
+	}
+}
+
 func TestFormat(t *testing.T) {
 	fmt.Println("TestFormat")
 	for i, test := range formatTest {
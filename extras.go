@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// kinds of extra files, see 'extras' setting
+const (
+	extraTranscript = "transcript"
+	extraChapters   = "chapters"
+)
+
+// ItemExtra is additional file of item, it is downloaded next to item file
+type ItemExtra struct {
+	Kind     string `json:"kind"` // transcript or chapters
+	Url      string `json:"url"`
+	Type     string `json:"type,omitempty"`
+	Language string `json:"language,omitempty"`
+	Path     string `json:"path,omitempty"` // full destination path, set when request is created
+}
+
+// parseExtrasSetting parses comma separated list of extra kinds, returns nil if extras are disabled
+func parseExtrasSetting(setting string) (map[string]bool, error) {
+	kinds := map[string]bool{}
+	for _, kind := range strings.Split(setting, ",") {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		switch kind {
+		case "":
+		case extraTranscript, extraChapters:
+			kinds[kind] = true
+		default:
+			return nil, fmt.Errorf("extras: unknown kind '%s', use %s or %s", kind, extraTranscript, extraChapters)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	return kinds, nil
+}
+
+// itemExtras returns extra files of item, which kinds are requested
+func itemExtras(item *FeedItem, kinds map[string]bool) []*ItemExtra {
+	extras := []*ItemExtra{}
+	if kinds[extraTranscript] {
+		for _, transcript := range item.Transcripts {
+			extras = append(extras, &ItemExtra{
+				Kind:     extraTranscript,
+				Url:      transcript.Url,
+				Type:     transcript.Type,
+				Language: transcript.Language,
+			})
+		}
+	}
+	if kinds[extraChapters] && item.Chapters != nil {
+		extras = append(extras, &ItemExtra{Kind: extraChapters, Url: item.Chapters.Url, Type: item.Chapters.Type})
+	}
+	if len(extras) == 0 {
+		return nil
+	}
+	return extras
+}
+
+// file extensions of transcript media types
+var transcriptExt = map[string]string{
+	"text/vtt":             ".vtt",
+	"application/x-subrip": ".srt",
+	"application/srt":      ".srt",
+	"text/srt":             ".srt",
+	"application/json":     ".json",
+	"text/html":            ".html",
+	"text/plain":           ".txt",
+}
+
+// extraExt returns file extension of extra file by media type, extension of url is used for unknown types
+func extraExt(extra *ItemExtra) string {
+	if extra.Kind == extraChapters {
+		return ".chapters.json"
+	}
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(extra.Type, ";")[0]))
+	if ext, ok := transcriptExt[mediaType]; ok {
+		return ext
+	}
+	if ext := path.Ext(buildFileName(extra.Url)); ext != "" && !strings.ContainsAny(ext, "?&=") {
+		return strings.ToLower(ext)
+	}
+	return ".txt"
+}
+
+// setExtraPaths sets paths of extra files of item: item path with extension of extra,
+// e.g. 'episode.mp3' -> 'episode.vtt'. Language or number is added, if path is used already
+func setExtraPaths(item *DownloadItem) {
+	base := strings.TrimSuffix(item.Path, filepath.Ext(item.Path))
+	used := map[string]bool{item.Path: true}
+	for i, extra := range item.Extras {
+		ext := extraExt(extra)
+		extra.Path = base + ext
+		if used[extra.Path] && extra.Language != "" {
+			extra.Path = base + "." + sanitizeFileName(extra.Language) + ext
+		}
+		if used[extra.Path] {
+			extra.Path = fmt.Sprintf("%s.%d%s", base, i+1, ext)
+		}
+		used[extra.Path] = true
+	}
+}
+
+// downloadExtras downloads extra files of item, returns errors of failed ones
+func downloadExtras(client *http.Client, item *DownloadItem) []error {
+	errs := []error{}
+	for _, extra := range item.Extras {
+		if err := downloadExtra(client, extra); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s: %v", extra.Kind, extra.Url, err))
+		}
+	}
+	return errs
+}
+
+// downloadExtra downloads extra file to temporary file and renames it to extra path
+func downloadExtra(client *http.Client, extra *ItemExtra) error {
+	resp, err := client.Get(extra.Url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+
+	tmpPath := extra.Path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, extra.Path)
+}
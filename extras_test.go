@@ -0,0 +1,99 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseExtrasSetting(t *testing.T) {
+	kinds, err := parseExtrasSetting("")
+	assert.NoError(t, err)
+	assert.Nil(t, kinds)
+
+	kinds, err = parseExtrasSetting(" Transcript , chapters")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"transcript": true, "chapters": true}, kinds)
+
+	_, err = parseExtrasSetting("transcript,cover")
+	assert.Error(t, err)
+}
+
+func TestSetExtraPaths(t *testing.T) {
+	item := &DownloadItem{
+		Path: filepath.Join("dir", "episode.mp3"),
+		Extras: []*ItemExtra{
+			{Kind: extraTranscript, Url: "http://show/1.vtt", Type: "text/vtt"},
+			{Kind: extraTranscript, Url: "http://show/1-de.vtt", Type: "text/vtt", Language: "de"},
+			{Kind: extraTranscript, Url: "http://show/1.srt?x=1"},
+			{Kind: extraTranscript, Url: "http://show/transcript"},
+			{Kind: extraChapters, Url: "http://show/1.json", Type: "application/json+chapters"},
+		},
+	}
+	setExtraPaths(item)
+	paths := []string{}
+	for _, extra := range item.Extras {
+		paths = append(paths, extra.Path)
+	}
+	assert.Equal(t, []string{
+		filepath.Join("dir", "episode.vtt"),
+		filepath.Join("dir", "episode.de.vtt"),
+		filepath.Join("dir", "episode.srt"),
+		filepath.Join("dir", "episode.txt"),
+		filepath.Join("dir", "episode.chapters.json"),
+	}, paths)
+}
+
+func TestItemExtras(t *testing.T) {
+	item := &FeedItem{
+		Transcripts: []*FeedLink{{Url: "http://show/1.vtt", Type: "text/vtt"}},
+		Chapters:    &FeedLink{Url: "http://show/1.json"},
+	}
+	assert.Nil(t, itemExtras(item, nil))
+	extras := itemExtras(item, map[string]bool{extraChapters: true})
+	if assert.Len(t, extras, 1) {
+		assert.Equal(t, extraChapters, extras[0].Kind)
+	}
+	assert.Len(t, itemExtras(item, map[string]bool{extraChapters: true, extraTranscript: true}), 2)
+}
+
+func TestDownloadExtras(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("WEBVTT"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "gopoddl")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	item := &DownloadItem{
+		Path: filepath.Join(dir, "episode.mp3"),
+		Extras: []*ItemExtra{
+			{Kind: extraTranscript, Url: srv.URL + "/1.vtt", Type: "text/vtt"},
+			{Kind: extraChapters, Url: srv.URL + "/missing"},
+		},
+	}
+	setExtraPaths(item)
+	errs := downloadExtras(http.DefaultClient, item)
+	assert.Len(t, errs, 1)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "episode.vtt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "WEBVTT", string(content))
+	assert.False(t, fileExists(filepath.Join(dir, "episode.chapters.json")))
+
+	history := &History{Entries: map[string]*HistoryEntry{}}
+	history.MarkDownloaded(item, item.Path)
+	assert.Equal(t, []string{filepath.Join(dir, "episode.vtt")}, history.Entries[historyKey("", "")].Extras)
+}
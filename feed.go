@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownFeedFormat is returned if feed is not RSS, Atom or JSON Feed
+var ErrUnknownFeedFormat = errors.New("feed: unknown feed format")
+
+// ErrNoChannels is returned if RSS feed has no channel
+var ErrNoChannels = errors.New("feed: no channels in feed")
+
+// namespaces of podcast extensions
+const (
+	podcastNamespace = "https://podcastindex.org/namespace/1.0"     // Podcasting 2.0
+	itunesNamespace  = "http://www.itunes.com/dtds/podcast-1.0.dtd" // iTunes
+)
+
+// FeedChannel is podcast feed independent of its format
+type FeedChannel struct {
+	Title       string
+	Description string
+	Link        string
+	Language    string
+	ImageUrl    string
+	Items       []*FeedItem
+}
+
+// FeedItem is one feed entry
+type FeedItem struct {
+	Guid        string // empty if feed has not it
+	Title       string
+	Description string
+	Link        string
+	PubDate     time.Time // zero if unknown
+	Enclosures  []*FeedEnclosure
+
+	// iTunes namespace
+	EpisodeType string        // full, trailer or bonus
+	Duration    time.Duration // zero if unknown
+	Explicit    string        // true, false or empty if unknown
+	Author      string
+
+	// Podcasting 2.0 namespace, season and episode are taken from iTunes namespace if missing
+	Season      string   // season number
+	Episode     string   // episode number, can be decimal
+	Persons     []string // names of hosts and guests
+	Transcripts []*FeedLink
+	Chapters    *FeedLink // nil if item has not chapters
+}
+
+// FeedEnclosure is media file of item
+type FeedEnclosure struct {
+	Url    string
+	Length int64
+	Type   string
+}
+
+// parseItunesDuration parses itunes:duration: seconds, MM:SS or HH:MM:SS
+func parseItunesDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("feed: empty duration")
+	}
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("feed: invalid duration '%s'", s)
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseItunesExplicit normalizes itunes:explicit to true or false, empty if unknown
+func parseItunesExplicit(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "yes", "explicit":
+		return "true"
+	case "false", "no", "clean":
+		return "false"
+	}
+	return ""
+}
+
+// FeedLink is additional resource of item: transcript or chapters
+type FeedLink struct {
+	Url      string
+	Type     string
+	Language string
+}
+
+// FeedParser parses feed of one format
+type FeedParser interface {
+	// Detect returns true if content looks like feed of parser format
+	Detect(content []byte) bool
+	Parse(url string, content []byte) (*FeedChannel, error)
+}
+
+// feedParsers are tried in order, RSS parser accepts any xml, so it is the last one
+var feedParsers = []FeedParser{jsonFeedParser{}, atomParser{}, rssParser{}}
+
+// parseFeed parses feed content by first parser, which detects its format
+func parseFeed(url string, content []byte) (*FeedChannel, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")) // utf-8 BOM
+	for _, parser := range feedParsers {
+		if parser.Detect(content) {
+			return parser.Parse(url, content)
+		}
+	}
+	return nil, ErrUnknownFeedFormat
+}
+
+// xmlRootElement returns name of root element of xml document
+func xmlRootElement(content []byte) (xml.Name, bool) {
+	d := xml.NewDecoder(bytes.NewReader(content))
+	// root element name is ascii, so charset does not matter
+	d.CharsetReader = func(label string, input io.Reader) (io.Reader, error) { return input, nil }
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return xml.Name{}, false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, true
+		}
+	}
+}
+
+// xmlCharsetReader supports utf-8 and latin-1 feeds
+func xmlCharsetReader(label string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(label) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1":
+		content, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		for _, b := range content {
+			buf.WriteRune(rune(b))
+		}
+		return &buf, nil
+	}
+	return nil, fmt.Errorf("feed: unsupported charset '%s'", label)
+}
+
+// parseFeedTime parses date in RFC 3339 or RFC 822 variants used by feeds
+func parseFeedTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	layouts := []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+		time.RFC1123Z,
+		time.RFC1123,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04:05 MST",
+		"Mon, 2 Jan 2006 15:04 -0700",
+		"2 Jan 2006 15:04:05 -0700",
+		time.RFC822Z,
+		time.RFC822,
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("feed: invalid date '%s'", s)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// atomParser parses Atom feeds, enclosures are links with rel="enclosure"
+type atomParser struct{}
+
+type atomFeed struct {
+	Title    atomText    `xml:"title"`
+	Subtitle atomText    `xml:"subtitle"`
+	Links    []atomLink  `xml:"link"`
+	Icon     string      `xml:"icon"`
+	Logo     string      `xml:"logo"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Id        string     `xml:"id"`
+	Title     atomText   `xml:"title"`
+	Summary   atomText   `xml:"summary"`
+	Content   atomText   `xml:"content"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Links     []atomLink `xml:"link"`
+
+	// Podcasting 2.0 namespace
+	Season      string           `xml:"https://podcastindex.org/namespace/1.0 season"`
+	Episode     string           `xml:"https://podcastindex.org/namespace/1.0 episode"`
+	Persons     []string         `xml:"https://podcastindex.org/namespace/1.0 person"`
+	Transcripts []atomPodcastRef `xml:"https://podcastindex.org/namespace/1.0 transcript"`
+	Chapters    *atomPodcastRef  `xml:"https://podcastindex.org/namespace/1.0 chapters"`
+}
+
+// atomPodcastRef is podcast:transcript or podcast:chapters element
+type atomPodcastRef struct {
+	Url      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+	Inner string `xml:",innerxml"` // xhtml content
+}
+
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Value)
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// alternate returns link to html page, link without rel is alternate one
+func atomAlternate(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+func (atomParser) Detect(content []byte) bool {
+	name, ok := xmlRootElement(content)
+	return ok && name.Local == "feed" && (name.Space == atomNamespace || name.Space == "")
+}
+
+func (atomParser) Parse(url string, content []byte) (*FeedChannel, error) {
+	feed := &atomFeed{}
+	d := xml.NewDecoder(bytes.NewReader(content))
+	d.CharsetReader = xmlCharsetReader
+	if err := d.Decode(feed); err != nil {
+		return nil, err
+	}
+
+	channel := &FeedChannel{
+		Title:       feed.Title.String(),
+		Description: feed.Subtitle.String(),
+		Link:        atomAlternate(feed.Links),
+		ImageUrl:    feed.Logo,
+	}
+	if channel.ImageUrl == "" {
+		channel.ImageUrl = feed.Icon
+	}
+	for _, entry := range feed.Entries {
+		item := &FeedItem{
+			Guid:        entry.Id,
+			Title:       entry.Title.String(),
+			Description: entry.Content.String(),
+			Link:        atomAlternate(entry.Links),
+		}
+		if item.Description == "" {
+			item.Description = entry.Summary.String()
+		}
+		published := entry.Published
+		if published == "" {
+			published = entry.Updated
+		}
+		if pubDate, err := parseFeedTime(published); err == nil {
+			item.PubDate = pubDate
+		}
+		for _, link := range entry.Links {
+			if link.Rel != "enclosure" || link.Href == "" {
+				continue
+			}
+			length, _ := strconv.ParseInt(strings.TrimSpace(link.Length), 10, 64)
+			item.Enclosures = append(item.Enclosures, &FeedEnclosure{
+				Url:    link.Href,
+				Length: length,
+				Type:   link.Type,
+			})
+		}
+		item.Season = strings.TrimSpace(entry.Season)
+		item.Episode = strings.TrimSpace(entry.Episode)
+		for _, person := range entry.Persons {
+			if name := strings.TrimSpace(person); name != "" {
+				item.Persons = append(item.Persons, name)
+			}
+		}
+		for _, transcript := range entry.Transcripts {
+			if transcript.Url != "" {
+				item.Transcripts = append(item.Transcripts, &FeedLink{Url: transcript.Url, Type: transcript.Type, Language: transcript.Language})
+			}
+		}
+		if entry.Chapters != nil && entry.Chapters.Url != "" {
+			item.Chapters = &FeedLink{Url: entry.Chapters.Url, Type: entry.Chapters.Type}
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return channel, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// jsonFeedParser parses JSON Feed (https://jsonfeed.org) version 1 and 1.1,
+// enclosures are item attachments
+type jsonFeedParser struct{}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageUrl string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Icon        string         `json:"icon"`
+	Favicon     string         `json:"favicon"`
+	Language    string         `json:"language"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	Id            jsonFeedId           `json:"id"`
+	Url           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentHtml   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+// jsonFeedId is string by spec, but numbers are common
+type jsonFeedId string
+
+func (id *jsonFeedId) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = jsonFeedId(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = jsonFeedId(n.String())
+	return nil
+}
+
+type jsonFeedAttachment struct {
+	Url         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+}
+
+func (jsonFeedParser) Detect(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(content), []byte("{"))
+}
+
+func (jsonFeedParser) Parse(url string, content []byte) (*FeedChannel, error) {
+	feed := &jsonFeed{}
+	if err := json.Unmarshal(content, feed); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(feed.Version, "https://jsonfeed.org/version/") {
+		return nil, ErrUnknownFeedFormat
+	}
+
+	channel := &FeedChannel{
+		Title:       feed.Title,
+		Description: feed.Description,
+		Link:        feed.HomePageUrl,
+		Language:    feed.Language,
+		ImageUrl:    feed.Icon,
+	}
+	if channel.ImageUrl == "" {
+		channel.ImageUrl = feed.Favicon
+	}
+	for _, jsonItem := range feed.Items {
+		item := &FeedItem{
+			Guid:        string(jsonItem.Id),
+			Title:       jsonItem.Title,
+			Description: jsonItem.ContentHtml,
+			Link:        jsonItem.Url,
+		}
+		if item.Description == "" {
+			item.Description = jsonItem.ContentText
+		}
+		if item.Description == "" {
+			item.Description = jsonItem.Summary
+		}
+		published := jsonItem.DatePublished
+		if published == "" {
+			published = jsonItem.DateModified
+		}
+		if pubDate, err := parseFeedTime(published); err == nil {
+			item.PubDate = pubDate
+		}
+		for _, attachment := range jsonItem.Attachments {
+			item.Enclosures = append(item.Enclosures, &FeedEnclosure{
+				Url:    attachment.Url,
+				Length: attachment.SizeInBytes,
+				Type:   attachment.MimeType,
+			})
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return channel, nil
+}
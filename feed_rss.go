@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+
+	rss "github.com/jteeuwen/go-pkg-rss"
+)
+
+// rssParser parses RSS 2.0 and RSS 1.0 feeds by go-pkg-rss
+type rssParser struct{}
+
+func (rssParser) Detect(content []byte) bool {
+	_, ok := xmlRootElement(content)
+	return ok
+}
+
+func (rssParser) Parse(url string, content []byte) (*FeedChannel, error) {
+	feed := rss.New(1, true, nil, nil)
+	if err := feed.FetchBytes(url, content, nil); err != nil {
+		return nil, err
+	}
+	if len(feed.Channels) == 0 {
+		return nil, ErrNoChannels
+	}
+	return convertRssChannel(feed.Channels[0]), nil
+}
+
+// convertRssChannel converts go-pkg-rss channel to feed model
+func convertRssChannel(rssChannel *rss.Channel) *FeedChannel {
+	channel := &FeedChannel{
+		Title:       rssChannel.Title,
+		Description: rssChannel.Description,
+		Language:    rssChannel.Language,
+		ImageUrl:    rssChannel.Image.Url,
+	}
+	if len(rssChannel.Links) > 0 {
+		channel.Link = rssChannel.Links[0].Href
+	}
+	channelAuthor := ""
+	if author := rssChannel.Extensions[itunesNamespace]["author"]; len(author) > 0 {
+		channelAuthor = strings.TrimSpace(author[0].Value)
+	}
+	for _, rssItem := range rssChannel.Items {
+		item := &FeedItem{
+			Title:       rssItem.Title,
+			Description: rssItem.Description,
+		}
+		if rssItem.Guid != nil {
+			item.Guid = *rssItem.Guid
+		}
+		if len(rssItem.Links) > 0 {
+			item.Link = rssItem.Links[0].Href
+		}
+		if pubDate, err := rssItem.ParsedPubDate(); err == nil {
+			item.PubDate = pubDate
+		} else if pubDate, err := parseFeedTime(rssItem.PubDate); err == nil {
+			item.PubDate = pubDate
+		}
+		for _, enclosure := range rssItem.Enclosures {
+			item.Enclosures = append(item.Enclosures, &FeedEnclosure{
+				Url:    enclosure.Url,
+				Length: enclosure.Length,
+				Type:   enclosure.Type,
+			})
+		}
+		convertPodcastExtensions(item, rssItem.Extensions[podcastNamespace])
+		convertItunesExtensions(item, rssItem.Extensions[itunesNamespace])
+		if item.Author == "" {
+			item.Author = channelAuthor
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	return channel
+}
+
+// convertPodcastExtensions reads Podcasting 2.0 elements of item
+func convertPodcastExtensions(item *FeedItem, extensions map[string][]rss.Extension) {
+	if extensions == nil {
+		return
+	}
+	if season := extensions["season"]; len(season) > 0 {
+		item.Season = strings.TrimSpace(season[0].Value)
+	}
+	if episode := extensions["episode"]; len(episode) > 0 {
+		item.Episode = strings.TrimSpace(episode[0].Value)
+	}
+	for _, person := range extensions["person"] {
+		if name := strings.TrimSpace(person.Value); name != "" {
+			item.Persons = append(item.Persons, name)
+		}
+	}
+	for _, transcript := range extensions["transcript"] {
+		if transcript.Attrs["url"] != "" {
+			item.Transcripts = append(item.Transcripts, &FeedLink{
+				Url:      transcript.Attrs["url"],
+				Type:     transcript.Attrs["type"],
+				Language: transcript.Attrs["language"],
+			})
+		}
+	}
+	if chapters := extensions["chapters"]; len(chapters) > 0 && chapters[0].Attrs["url"] != "" {
+		item.Chapters = &FeedLink{Url: chapters[0].Attrs["url"], Type: chapters[0].Attrs["type"]}
+	}
+}
+
+// convertItunesExtensions reads iTunes elements of item,
+// season and episode are set only if Podcasting 2.0 ones are missing
+func convertItunesExtensions(item *FeedItem, extensions map[string][]rss.Extension) {
+	value := func(name string) string {
+		if ext := extensions[name]; len(ext) > 0 {
+			return strings.TrimSpace(ext[0].Value)
+		}
+		return ""
+	}
+	if extensions == nil {
+		return
+	}
+	item.EpisodeType = strings.ToLower(value("episodeType"))
+	if duration, err := parseItunesDuration(value("duration")); err == nil {
+		item.Duration = duration
+	}
+	item.Explicit = parseItunesExplicit(value("explicit"))
+	item.Author = value("author")
+	if item.Season == "" {
+		item.Season = value("season")
+	}
+	if item.Episode == "" {
+		item.Episode = value("episode")
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseRssFeed(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+	<title>Show</title>
+	<link>http://show/</link>
+	<description>About show</description>
+	<image><url>http://show/cover.jpg</url></image>
+	<item>
+		<title>Episode 1</title>
+		<guid>ep-1</guid>
+		<pubDate>Thu, 11 Aug 2016 14:21:57 +0300</pubDate>
+		<description>First</description>
+		<enclosure url="http://show/1.mp3" length="100" type="audio/mpeg"/>
+	</item>
+</channel>
+</rss>`
+	channel, err := parseFeed("http://show/rss", []byte(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Show", channel.Title)
+	assert.Equal(t, "http://show/", channel.Link)
+	assert.Equal(t, "http://show/cover.jpg", channel.ImageUrl)
+	if assert.Len(t, channel.Items, 1) {
+		item := channel.Items[0]
+		assert.Equal(t, "ep-1", item.Guid)
+		assert.Equal(t, "First", item.Description)
+		assert.True(t, time.Date(2016, 8, 11, 11, 21, 57, 0, time.UTC).Equal(item.PubDate))
+		assert.Equal(t, []*FeedEnclosure{{Url: "http://show/1.mp3", Length: 100, Type: "audio/mpeg"}}, item.Enclosures)
+	}
+}
+
+func TestParseAtomFeed(t *testing.T) {
+	content := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Show</title>
+	<subtitle>About show</subtitle>
+	<link href="http://show/atom" rel="self"/>
+	<link href="http://show/"/>
+	<logo>http://show/cover.jpg</logo>
+	<entry>
+		<id>urn:ep-1</id>
+		<title type="html">Episode &amp; 1</title>
+		<updated>2016-08-12T10:00:00Z</updated>
+		<published>2016-08-11T14:21:57+03:00</published>
+		<summary>Short</summary>
+		<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml">Long</div></content>
+		<link href="http://show/1.html"/>
+		<link rel="enclosure" href="http://show/1.mp3" length="100" type="audio/mpeg"/>
+		<link rel="enclosure" href="http://show/1.ogg" type="audio/ogg"/>
+	</entry>
+	<entry>
+		<id>urn:ep-2</id>
+		<title>Text only</title>
+		<updated>2016-08-12T10:00:00Z</updated>
+		<summary>Short</summary>
+	</entry>
+</feed>`
+	channel, err := parseFeed("http://show/atom", []byte(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Show", channel.Title)
+	assert.Equal(t, "About show", channel.Description)
+	assert.Equal(t, "http://show/", channel.Link)
+	assert.Equal(t, "http://show/cover.jpg", channel.ImageUrl)
+	if !assert.Len(t, channel.Items, 2) {
+		return
+	}
+	item := channel.Items[0]
+	assert.Equal(t, "urn:ep-1", item.Guid)
+	assert.Equal(t, "Episode & 1", item.Title)
+	assert.Contains(t, item.Description, "Long")
+	assert.Equal(t, "http://show/1.html", item.Link)
+	assert.True(t, time.Date(2016, 8, 11, 11, 21, 57, 0, time.UTC).Equal(item.PubDate))
+	assert.Equal(t, []*FeedEnclosure{
+		{Url: "http://show/1.mp3", Length: 100, Type: "audio/mpeg"},
+		{Url: "http://show/1.ogg", Type: "audio/ogg"},
+	}, item.Enclosures)
+
+	assert.Equal(t, "Short", channel.Items[1].Description)
+	assert.True(t, time.Date(2016, 8, 12, 10, 0, 0, 0, time.UTC).Equal(channel.Items[1].PubDate))
+	assert.Empty(t, channel.Items[1].Enclosures)
+}
+
+func TestParseJSONFeed(t *testing.T) {
+	content := `{
+		"version": "https://jsonfeed.org/version/1.1",
+		"title": "Show",
+		"home_page_url": "http://show/",
+		"icon": "http://show/cover.jpg",
+		"items": [
+			{
+				"id": "ep-1",
+				"title": "Episode 1",
+				"content_text": "First",
+				"date_published": "2016-08-11T14:21:57+03:00",
+				"attachments": [{"url": "http://show/1.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 100}]
+			},
+			{"id": 2, "content_html": "<p>Second</p>"}
+		]
+	}`
+	channel, err := parseFeed("http://show/feed.json", []byte(content))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Show", channel.Title)
+	assert.Equal(t, "http://show/cover.jpg", channel.ImageUrl)
+	if !assert.Len(t, channel.Items, 2) {
+		return
+	}
+	item := channel.Items[0]
+	assert.Equal(t, "ep-1", item.Guid)
+	assert.Equal(t, "First", item.Description)
+	assert.True(t, time.Date(2016, 8, 11, 11, 21, 57, 0, time.UTC).Equal(item.PubDate))
+	assert.Equal(t, []*FeedEnclosure{{Url: "http://show/1.mp3", Length: 100, Type: "audio/mpeg"}}, item.Enclosures)
+	assert.Equal(t, "2", channel.Items[1].Guid)
+	assert.Equal(t, "<p>Second</p>", channel.Items[1].Description)
+
+	_, err = parseFeed("http://show/feed.json", []byte(`{"title": "not a feed"}`))
+	assert.Equal(t, ErrUnknownFeedFormat, err)
+	_, err = parseFeed("http://show/", []byte(`not a feed`))
+	assert.Equal(t, ErrUnknownFeedFormat, err)
+}
+
+func TestParseFeedTime(t *testing.T) {
+	for _, s := range []string{
+		"2016-08-11T14:21:57+03:00",
+		"Thu, 11 Aug 2016 14:21:57 +0300",
+		"Thu, 11 Aug 2016 14:21:57 GMT",
+		"Thu, 1 Aug 2016 14:21:57 +0300",
+		"2016-08-11",
+	} {
+		_, err := parseFeedTime(s)
+		assert.NoError(t, err, s)
+	}
+	_, err := parseFeedTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestParsePodcastNamespace(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:podcast="https://podcastindex.org/namespace/1.0">
+<channel>
+	<title>Show</title>
+	<item>
+		<title>Episode 1</title>
+		<enclosure url="http://show/1.mp3" length="100" type="audio/mpeg"/>
+		<podcast:season name="Pilot">2</podcast:season>
+		<podcast:episode>3.5</podcast:episode>
+		<podcast:person role="host">Jane Doe</podcast:person>
+		<podcast:person role="guest">John Smith</podcast:person>
+		<podcast:transcript url="http://show/1.vtt" type="text/vtt"/>
+		<podcast:transcript url="http://show/1.srt" type="application/x-subrip" language="de"/>
+		<podcast:chapters url="http://show/1.json" type="application/json+chapters"/>
+	</item>
+</channel>
+</rss>`
+	channel, err := parseFeed("http://show/rss", []byte(content))
+	if !assert.NoError(t, err) || !assert.Len(t, channel.Items, 1) {
+		return
+	}
+	item := channel.Items[0]
+	assert.Equal(t, "2", item.Season)
+	assert.Equal(t, "3.5", item.Episode)
+	assert.Equal(t, []string{"Jane Doe", "John Smith"}, item.Persons)
+	assert.Equal(t, []*FeedLink{
+		{Url: "http://show/1.vtt", Type: "text/vtt"},
+		{Url: "http://show/1.srt", Type: "application/x-subrip", Language: "de"},
+	}, item.Transcripts)
+	assert.Equal(t, &FeedLink{Url: "http://show/1.json", Type: "application/json+chapters"}, item.Chapters)
+
+	atom := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:podcast="https://podcastindex.org/namespace/1.0">
+	<title>Show</title>
+	<entry>
+		<id>urn:ep-1</id>
+		<title>Episode 1</title>
+		<link rel="enclosure" href="http://show/1.mp3" type="audio/mpeg"/>
+		<podcast:season>1</podcast:season>
+		<podcast:episode>7</podcast:episode>
+		<podcast:person>Jane Doe</podcast:person>
+		<podcast:transcript url="http://show/1.vtt" type="text/vtt"/>
+		<podcast:chapters url="http://show/1.json" type="application/json+chapters"/>
+	</entry>
+</feed>`
+	channel, err = parseFeed("http://show/atom", []byte(atom))
+	if !assert.NoError(t, err) || !assert.Len(t, channel.Items, 1) {
+		return
+	}
+	item = channel.Items[0]
+	assert.Equal(t, "1", item.Season)
+	assert.Equal(t, "7", item.Episode)
+	assert.Equal(t, []string{"Jane Doe"}, item.Persons)
+	assert.Equal(t, []*FeedLink{{Url: "http://show/1.vtt", Type: "text/vtt"}}, item.Transcripts)
+	assert.Equal(t, &FeedLink{Url: "http://show/1.json", Type: "application/json+chapters"}, item.Chapters)
+}
+
+func TestParseItunesNamespace(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+	<title>Show</title>
+	<itunes:author>Show Team</itunes:author>
+	<item>
+		<title>Episode 5</title>
+		<enclosure url="http://show/5.mp3" length="100" type="audio/mpeg"/>
+		<itunes:episodeType>Full</itunes:episodeType>
+		<itunes:duration>1:02:03</itunes:duration>
+		<itunes:explicit>yes</itunes:explicit>
+		<itunes:season>2</itunes:season>
+		<itunes:episode>5</itunes:episode>
+		<itunes:author>Jane Doe</itunes:author>
+	</item>
+	<item>
+		<title>Trailer</title>
+		<enclosure url="http://show/0.mp3" length="100" type="audio/mpeg"/>
+		<itunes:episodeType>trailer</itunes:episodeType>
+		<itunes:duration>95</itunes:duration>
+	</item>
+</channel>
+</rss>`
+	channel, err := parseFeed("http://show/rss", []byte(content))
+	if !assert.NoError(t, err) || !assert.Len(t, channel.Items, 2) {
+		return
+	}
+	item := channel.Items[0]
+	assert.Equal(t, "full", item.EpisodeType)
+	assert.Equal(t, time.Hour+2*time.Minute+3*time.Second, item.Duration)
+	assert.Equal(t, "true", item.Explicit)
+	assert.Equal(t, "2", item.Season)
+	assert.Equal(t, "5", item.Episode)
+	assert.Equal(t, "Jane Doe", item.Author)
+
+	item = channel.Items[1]
+	assert.Equal(t, "trailer", item.EpisodeType)
+	assert.Equal(t, 95*time.Second, item.Duration)
+	assert.Equal(t, "", item.Explicit)
+	assert.Equal(t, "Show Team", item.Author)
+}
+
+func TestParseItunesDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"95":       95 * time.Second,
+		"12:05":    12*time.Minute + 5*time.Second,
+		"01:00:30": time.Hour + 30*time.Second,
+		"90.5":     90*time.Second + 500*time.Millisecond,
+	} {
+		d, err := parseItunesDuration(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+	for _, s := range []string{"", "1h", "1:-2"} {
+		_, err := parseItunesDuration(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"fmt"
+	"mime"
 	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
-
-	rss "github.com/jteeuwen/go-pkg-rss"
+	"unicode/utf8"
 )
 
 type Filter struct {
@@ -14,39 +19,65 @@ type Filter struct {
 	Count        int
 	StartDate    time.Time
 	Filter       string
+	IgnoreCase   bool // filter is case insensitive
 	DateFormat   string
 	SeperatePath string
+	FileName     string // file name format, file name from url if empty
 	LastSynced   time.Time
+	Extras       string          // 'extras' setting, kinds of extra files to download
+	History      *History        // already downloaded or seen items, can be nil
+	compiled     *CompiledFilter // Filter compiled on first use
 }
 
 type DownloadItem struct {
-	Title     string // will used for log output
-	Dir       string // seperate dir, can be empty
-	Filename  string // file name from url
-	Url       string // url to downaload
-	Size      int64
-	ItemTitle string
+	Title     string    `json:"title"`          // will used for log output
+	Dir       string    `json:"dir,omitempty"`  // seperate dir, can be empty
+	Filename  string    `json:"filename"`       // file name from url
+	Path      string    `json:"path,omitempty"` // full destination path, set when request is created
+	Url       string    `json:"url"`            // url to downaload
+	Size      int64     `json:"size"`
+	Type      string    `json:"type,omitempty"` // enclosure media type
+	ItemTitle string    `json:"item-title"`
+	Guid      string    `json:"guid,omitempty"` // item guid, used as history key
+	PubDate   time.Time `json:"pub-date"`       // item publish date
+
+	Duration time.Duration `json:"duration,omitempty"` // itunes:duration, 0 if unknown
+
+	Extras []*ItemExtra `json:"extras,omitempty"` // transcripts and chapters to download next to item
+
+	Tokens map[string]string `json:"-"` // format tokens of item, used for tags
 }
 
-// FilterItems filters items from podcast RSS, returns all passed DownloadItems
-func (f *Filter) FilterItems(rssChannel *rss.Channel) ([]*DownloadItem, error) {
+// FilterItems filters items from podcast feed, returns all passed DownloadItems
+func (f *Filter) FilterItems(channel *FeedChannel) ([]*DownloadItem, error) {
+	extraKinds, err := parseExtrasSetting(f.Extras)
+	if err != nil {
+		return nil, err
+	}
+	if f.Filter != "" && f.compiled == nil {
+		if f.compiled, err = CompileFilter(f.Filter, f.IgnoreCase); err != nil {
+			return nil, fmt.Errorf("filter: %v", err)
+		}
+	}
 	itemsToDownload := []*DownloadItem{}
-	items := rssChannel.Items
+	items := channel.Items
+	indexes := itemIndexes(items)
 	// filter by date
 	for _, item := range items {
-		itemDate, _ := item.ParsedPubDate()
-		if !f.StartDate.IsZero() {
-			if itemDate.Before(f.StartDate) {
-				log.Debug("filter:skipped by StartDate: ", item.Title)
-				continue
-			}
-		} else if itemDate.Before(f.LastSynced) {
-			log.Debug("filter:skipped by LastSynced: ", item.Title)
+		itemDate := item.PubDate
+		if f.skippedByDate(item) {
+			log.Debug("filter:skipped by date: ", item.Title)
 			continue
 		}
 
 	E:
 		for _, enclosure := range item.Enclosures {
+			// filter by history
+			if f.hasHistory() && f.History.Known(item.Guid, enclosure.Url) {
+				log.Debug("filter:skipped by history: ", item.Title)
+				continue E
+			}
+
 			// filter by mediatype
 			if len(f.MediaType) > 0 {
 				toSkip := true
@@ -60,16 +91,9 @@ func (f *Filter) FilterItems(rssChannel *rss.Channel) ([]*DownloadItem, error) {
 			}
 
 			// filter by condition
-			// {{ItemTitle}}, {{ItemUrl}}, {{ItemDescription}}
 			if f.Filter != "" {
-				data := map[string]string{
-					"ItemTitle":       item.Title,
-					"ItemDescription": item.Description,
-					"ItemUrl":         enclosure.Url,
-				}
-				if ok, err := EvalFilter(f.Filter, data); err != nil {
-					log.Fatal("filter:error:", err)
-					continue E
+				if ok, err := f.compiled.Eval(filterData(item, enclosure)); err != nil {
+					return nil, fmt.Errorf("filter: %v", err)
 				} else {
 					if !ok {
 						log.Debug("filter:skipped by filter condition: ", item.Title)
@@ -78,31 +102,35 @@ func (f *Filter) FilterItems(rssChannel *rss.Channel) ([]*DownloadItem, error) {
 				}
 			}
 
-			// add dir
-			// {{Title}}, {{Name}}, {{ItemPubDate}}, {{ItemTitle}}, {{CurrentDate}}
+			// add dir and file name
+			data := f.formatData(channel, item, enclosure, indexes[item])
 			sepPath := ""
 			if f.SeperatePath != "" {
-				d, _ := item.ParsedPubDate()
-				data := map[string]string{
-					"Title":       rssChannel.Title,
-					"Name":        f.PodcastName,
-					"ItemTitle":   item.Title,
-					"CurrentDate": time.Now().Format(f.DateFormat),
-					"ItemPubDate": d.Format(f.DateFormat),
+				sepPath = formatDirPath(f.SeperatePath, data)
+			}
+			fileName := data["ItemFileName"]
+			if f.FileName != "" {
+				if name := formatFileName(f.FileName, data); name != "" {
+					fileName = name
 				}
-				sepPath = EvalFormat(f.SeperatePath, data)
 			}
 
 			// add url to list
 			log.Debug("filter:added to download list:", item.Title)
 			itemsToDownload = append(itemsToDownload,
 				&DownloadItem{
-					Filename:  buildFileName(enclosure.Url),
+					Filename:  fileName,
 					Dir:       sepPath,
 					Url:       enclosure.Url,
-					Title:     rssChannel.Title,
+					Title:     channel.Title,
 					Size:      enclosure.Length,
+					Type:      enclosure.Type,
 					ItemTitle: item.Title,
+					Guid:      item.Guid,
+					PubDate:   itemDate,
+					Duration:  item.Duration,
+					Extras:    itemExtras(item, extraKinds),
+					Tokens:    data,
 				})
 		}
 
@@ -118,21 +146,206 @@ func (f *Filter) FilterItems(rssChannel *rss.Channel) ([]*DownloadItem, error) {
 	return itemsToDownload[0:count], nil
 }
 
+// filterData returns tokens of filter: {{ItemTitle}}, {{ItemUrl}}, {{ItemDescription}}, {{ItemSeason}}, ...
+// size, duration and date are typed values for comparison operators
+func filterData(item *FeedItem, enclosure *FeedEnclosure) map[string]string {
+	data := map[string]string{
+		"ItemTitle":       item.Title,
+		"ItemDescription": item.Description,
+		"ItemUrl":         enclosure.Url,
+		"ItemSize":        "",
+		"ItemPubDate":     "",
+	}
+	addExtensionTokens(data, item)
+	if enclosure.Length > 0 {
+		data["ItemSize"] = strconv.FormatInt(enclosure.Length, 10)
+	}
+	if !item.PubDate.IsZero() {
+		data["ItemPubDate"] = item.PubDate.Format("2006-01-02")
+	}
+	return data
+}
+
+// formatData returns tokens of separate-dir, file-name and tags:
+// {{Title}}, {{Name}}, {{ItemPubDate}}, {{ItemTitle}}, {{CurrentDate}}, ...
+func (f *Filter) formatData(channel *FeedChannel, item *FeedItem, enclosure *FeedEnclosure, index int) map[string]string {
+	data := map[string]string{
+		"Title":        channel.Title,
+		"Name":         f.PodcastName,
+		"ItemTitle":    item.Title,
+		"ItemUrl":      enclosure.Url,
+		"ItemFileName": buildFileName(enclosure.Url),
+		"ItemExt":      buildFileExt(enclosure.Url, enclosure.Type),
+		"ItemIndex":    strconv.Itoa(index),
+		"CurrentDate":  time.Now().Format(f.DateFormat),
+		"ItemPubDate":  item.PubDate.Format(f.DateFormat),
+
+		"ItemDescription": item.Description,
+	}
+	addExtensionTokens(data, item)
+	return data
+}
+
+// addExtensionTokens adds tokens of iTunes and Podcasting 2.0 elements of item,
+// tokens of unknown values are empty
+func addExtensionTokens(data map[string]string, item *FeedItem) {
+	data["ItemSeason"] = padNumber(item.Season)
+	data["ItemEpisode"] = padNumber(item.Episode)
+	data["ItemPersons"] = strings.Join(item.Persons, ", ")
+	data["ItemEpisodeType"] = item.EpisodeType
+	data["ItemExplicit"] = item.Explicit
+	data["ItemAuthor"] = item.Author
+	data["ItemDuration"] = ""
+	if item.Duration > 0 {
+		data["ItemDuration"] = strconv.FormatInt(int64(item.Duration/time.Second), 10)
+	}
+}
+
+// padNumber pads integer to two digits, e.g. '5' -> '05', other values are returned as is
+func padNumber(s string) string {
+	if len(s) == 1 && s[0] >= '0' && s[0] <= '9' {
+		return "0" + s
+	}
+	return s
+}
+
+// skippedByDate returns true if item is older than start date,
+// or than last sync if history is empty (first run)
+func (f *Filter) skippedByDate(item *FeedItem) bool {
+	if !f.StartDate.IsZero() {
+		return item.PubDate.Before(f.StartDate)
+	}
+	return !f.hasHistory() && item.PubDate.Before(f.LastSynced)
+}
+
+// SkippedByDate returns items of channel skipped by start date or last sync
+func (f *Filter) SkippedByDate(channel *FeedChannel) []*FeedItem {
+	items := []*FeedItem{}
+	for _, item := range channel.Items {
+		if f.skippedByDate(item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// history is used only when it has entries
+func (f *Filter) hasHistory() bool {
+	return f.History != nil && f.History.Len() > 0
+}
+
 // MakeFilter creates new filter from podcast settings
 func MakeFilter(podcast *Podcast) *Filter {
 	return &Filter{
 		PodcastName:  podcast.Name,
 		MediaType:    podcast.Mtype,
 		Filter:       podcast.Filter,
+		IgnoreCase:   podcast.FilterCaseInsensitive,
 		DateFormat:   podcast.DateFormat,
 		SeperatePath: podcast.SeparateDir,
+		FileName:     podcast.FileName,
 		LastSynced:   podcast.LastSynced,
+		Extras:       podcast.Extras,
+	}
+}
+
+// itemIndexes numbers items by publish date starting from 1 for the oldest one,
+// items with same date are ordered as in feed (newest first)
+func itemIndexes(items []*FeedItem) map[*FeedItem]int {
+	sorted := make([]*FeedItem, len(items))
+	for i, item := range items {
+		sorted[len(items)-1-i] = item
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].PubDate.Before(sorted[j].PubDate)
+	})
+	indexes := make(map[*FeedItem]int, len(items))
+	for i, item := range sorted {
+		indexes[item] = i + 1
 	}
+	return indexes
 }
 
 // clean up file name
 func buildFileName(uri string) string {
-	filename := uri[strings.LastIndex(uri, "/"):len(uri)]
-	escaped, _ := url.QueryUnescape(filename)
-	return escaped
+	filename := uri[strings.LastIndex(uri, "/")+1 : len(uri)]
+	if u, err := url.Parse(uri); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		filename = path.Base(u.Path)
+	}
+	escaped, err := url.QueryUnescape(filename)
+	if err != nil {
+		escaped = filename
+	}
+	return sanitizeFileName(escaped)
+}
+
+// well known podcast media types, used if url has no extension
+var mediaTypeExt = map[string]string{
+	"audio/mpeg":      ".mp3",
+	"audio/mp3":       ".mp3",
+	"audio/mp4":       ".m4a",
+	"audio/x-m4a":     ".m4a",
+	"audio/aac":       ".aac",
+	"audio/ogg":       ".ogg",
+	"audio/opus":      ".opus",
+	"audio/wav":       ".wav",
+	"video/mp4":       ".mp4",
+	"video/x-m4v":     ".m4v",
+	"video/quicktime": ".mov",
+	"video/webm":      ".webm",
+}
+
+// file extension with leading dot from url or from media type
+func buildFileExt(uri, mediaType string) string {
+	if u, err := url.Parse(uri); err == nil {
+		if ext := path.Ext(u.Path); ext != "" {
+			return replaceIllegalChars(ext)
+		}
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(strings.Split(mediaType, ";")[0]))
+	if ext, ok := mediaTypeExt[mediaType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// build relative dir path from format, tokens values are cleaned up as for file name
+// and each path element is sanitized, so path cannot be absolute or contain '..'
+func formatDirPath(format string, data map[string]string) string {
+	cleanData := make(map[string]string, len(data))
+	for k, v := range data {
+		cleanData[k] = replaceIllegalChars(v)
+	}
+	elems := []string{}
+	for _, elem := range strings.Split(filepath.ToSlash(EvalFormat(format, cleanData)), "/") {
+		if elem = sanitizeFileName(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return filepath.Join(elems...)
+}
+
+// maxFileNameLen is file name length limit in bytes, most of filesystems allow 255
+const maxFileNameLen = 240
+
+// build file name from format, tokens values are cleaned up
+// so they cannot add path separators or other illegal characters
+func formatFileName(format string, data map[string]string) string {
+	cleanData := make(map[string]string, len(data))
+	for k, v := range data {
+		cleanData[k] = replaceIllegalChars(v)
+	}
+	name := sanitizeFileName(EvalFormat(format, cleanData))
+	if len(name) > maxFileNameLen {
+		ext := path.Ext(name)
+		base := name[:len(name)-len(ext)]
+		for len(base) > 0 && (len(base)+len(ext) > maxFileNameLen || !utf8.ValidString(base)) {
+			base = base[:len(base)-1]
+		}
+		name = base + ext
+	}
+	return name
 }
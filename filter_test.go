@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestBuildFileName(t *testing.T) {
+	assert.Equal(t, "media.mp3", buildFileName("http://localhost/1/media.mp3"))
+	assert.Equal(t, "download", buildFileName("http://localhost/download?id=15"))
+	assert.Equal(t, "Episode 1.mp3", buildFileName("http://localhost/Episode%201.mp3"))
+
+	assert.Equal(t, ".mp3", buildFileExt("http://localhost/media.mp3?x=1", "audio/mpeg"))
+	assert.Equal(t, ".m4a", buildFileExt("http://localhost/download?id=15", "audio/x-m4a"))
+	assert.Equal(t, "", buildFileExt("http://localhost/download", ""))
+}
+
+func TestFormatFileName(t *testing.T) {
+	data := map[string]string{
+		"ItemTitle":   "What? AC/DC: live",
+		"ItemPubDate": "20160811",
+		"ItemExt":     ".mp3",
+		"ItemIndex":   "7",
+	}
+	assert.Equal(t, "20160811 - What_ AC_DC_ live.mp3",
+		formatFileName("{{ItemPubDate}} - {{ItemTitle}}{{ItemExt}}", data))
+	assert.Equal(t, "007_bad.mp3", formatFileName("00{{ItemIndex}}/bad{{ItemExt}}", data))
+
+	data["ItemTitle"] = strings.Repeat("Хрусталев ", 50)
+	name := formatFileName("{{ItemTitle}}{{ItemExt}}", data)
+	assert.True(t, len(name) <= maxFileNameLen, "file name is too long")
+	assert.True(t, strings.HasSuffix(name, ".mp3"), "extension is lost")
+}
+
+func TestFormatDirPath(t *testing.T) {
+	data := map[string]string{"Title": "AC/DC", "ItemTitle": "..", "ItemPubDate": "20160811"}
+	assert.Equal(t, filepath.Join("AC_DC", "20160811"), formatDirPath("{{Title}}/{{ItemPubDate}}", data))
+	assert.Equal(t, "20160811", formatDirPath("{{ItemTitle}}/{{ItemPubDate}}", data), "'..' token should be dropped")
+	assert.Equal(t, filepath.Join("etc", "AC_DC"), formatDirPath("/../../etc/{{Title}}", data), "path should stay relative")
+}
+
+func TestUniqueFileName(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testfilename")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	if err = ioutil.WriteFile(filepath.Join(tmpDir, "media.mp3"), nil, 0666); err != nil {
+		t.Fatal("Failed to create file", err)
+	}
+
+	used := map[string]bool{}
+	assert.Equal(t, "media (2).mp3", uniqueFileName(tmpDir, "media.mp3", used))
+	assert.Equal(t, "media (3).mp3", uniqueFileName(tmpDir, "media.mp3", used))
+	assert.Equal(t, "other.mp3", uniqueFileName(tmpDir, "other.mp3", used))
+}
+
+func TestExtensionTokens(t *testing.T) {
+	item := &FeedItem{
+		Title:       "Trailer",
+		EpisodeType: "trailer",
+		Duration:    95 * time.Second,
+		Season:      "2",
+		Episode:     "15",
+		Persons:     []string{"Jane Doe", "John Smith"},
+		Enclosures:  []*FeedEnclosure{{Url: "http://show/0.mp3", Type: "audio/mpeg"}},
+	}
+	data := map[string]string{}
+	addExtensionTokens(data, item)
+	assert.Equal(t, "02", data["ItemSeason"])
+	assert.Equal(t, "15", data["ItemEpisode"])
+	assert.Equal(t, "95", data["ItemDuration"])
+	assert.Equal(t, "Jane Doe, John Smith", data["ItemPersons"])
+	assert.Equal(t, "", data["ItemExplicit"])
+	assert.Equal(t, "S02E15 - Trailer.mp3",
+		formatFileName("S{{ItemSeason}}E{{ItemEpisode}} - {{ItemTitle}}.mp3", map[string]string{
+			"ItemSeason": data["ItemSeason"], "ItemEpisode": data["ItemEpisode"], "ItemTitle": item.Title,
+		}))
+
+	filter := &Filter{Count: -1, Filter: "'trailer' not in {{ItemEpisodeType}}"}
+	items, err := filter.FilterItems(&FeedChannel{Items: []*FeedItem{item}})
+	assert.NoError(t, err)
+	assert.Len(t, items, 0)
+}
+
+func TestFilterComparison(t *testing.T) {
+	channel := &FeedChannel{Items: []*FeedItem{
+		{Title: "new long", PubDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Duration: time.Hour,
+			Enclosures: []*FeedEnclosure{{Url: "http://show/3.mp3", Length: 5000}}},
+		{Title: "new short", PubDate: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), Duration: time.Minute,
+			Enclosures: []*FeedEnclosure{{Url: "http://show/2.mp3", Length: 5000}}},
+		{Title: "old long", PubDate: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), Duration: time.Hour,
+			Enclosures: []*FeedEnclosure{{Url: "http://show/1.mp3"}}},
+	}}
+	filter := &Filter{
+		Count:      -1,
+		DateFormat: "20060102",
+		Filter:     "{{ItemDuration}} > 10m and {{ItemPubDate}} >= '2024-01-01' and {{ItemSize}} > 1000",
+	}
+	items, err := filter.FilterItems(channel)
+	assert.NoError(t, err)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "new long", items[0].ItemTitle)
+	}
+}
+
+func TestFilterLargeFeed(t *testing.T) {
+	channel := &FeedChannel{}
+	for i := 0; i < 2000; i++ {
+		channel.Items = append(channel.Items, &FeedItem{
+			Title:      "Episode " + strconv.Itoa(i),
+			Enclosures: []*FeedEnclosure{{Url: "http://show/" + strconv.Itoa(i) + ".mp3"}},
+		})
+	}
+	filter := &Filter{Count: -1, Filter: "{{ItemTitle}} matches '0$' and not ('Episode 1' in prefix {{ItemTitle}})"}
+	items, err := filter.FilterItems(channel)
+	assert.NoError(t, err)
+	assert.Len(t, items, 200-111) // 10, 100-190 and 1000-1990 start with "Episode 1"
+
+	// filter is compiled once and reused
+	compiled := filter.compiled
+	assert.NotNil(t, compiled)
+	filter.FilterItems(channel)
+	assert.True(t, compiled == filter.compiled)
+}
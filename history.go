@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	historyDownloaded = "downloaded" // item was downloaded successfully
+	historySeen       = "seen"       // item was in feed, but was not requested
+	historyDeleted    = "deleted"    // item was downloaded, file was removed by retention policy
+)
+
+// HistoryEntry is one podcast item enclosure known to gopoddl
+type HistoryEntry struct {
+	Guid       string        `json:"guid,omitempty"`
+	Url        string        `json:"url"`
+	Status     string        `json:"status"`
+	Filename   string        `json:"filename,omitempty"`
+	Size       int64         `json:"size,omitempty"`
+	Type       string        `json:"type,omitempty"`
+	ItemTitle  string        `json:"item-title,omitempty"`
+	Extras     []string      `json:"extras,omitempty"` // paths of downloaded transcripts and chapters
+	PubDate    time.Time     `json:"pub-date"`
+	Duration   time.Duration `json:"duration,omitempty"` // 0 if unknown
+	RecordedAt time.Time     `json:"recorded-at"`
+}
+
+// History is per podcast download ledger, entries are keyed by item GUID plus enclosure url
+type History struct {
+	path    string
+	mu      sync.Mutex
+	Entries map[string]*HistoryEntry `json:"entries"`
+}
+
+// historyKey builds ledger key for item enclosure
+func historyKey(guid, url string) string {
+	return guid + "|" + url
+}
+
+// LoadHistory reads ledger from file, missing file means empty history
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path, Entries: map[string]*HistoryEntry{}}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return h, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(content, h); err != nil {
+		return nil, err
+	}
+	if h.Entries == nil {
+		h.Entries = map[string]*HistoryEntry{}
+	}
+	return h, nil
+}
+
+// Save writes ledger to disk, file is replaced atomically
+func (h *History) Save() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	content, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0777); err != nil {
+		return err
+	}
+	tmpPath := h.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, h.path)
+}
+
+// Len returns number of entries in ledger
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.Entries)
+}
+
+// Known returns true if item enclosure was downloaded or seen already
+func (h *History) Known(guid, url string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.Entries[historyKey(guid, url)]
+	return ok
+}
+
+// Downloaded returns all downloaded entries
+func (h *History) Downloaded() []*HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	entries := []*HistoryEntry{}
+	for _, e := range h.Entries {
+		if e.Status == historyDownloaded {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// MarkDownloaded records successfully downloaded item
+func (h *History) MarkDownloaded(item *DownloadItem, filename string) {
+	extras := []string{}
+	for _, extra := range item.Extras {
+		if fileExists(extra.Path) {
+			extras = append(extras, extra.Path)
+		}
+	}
+	if len(extras) == 0 {
+		extras = nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.Entries[historyKey(item.Guid, item.Url)] = &HistoryEntry{
+		Guid:       item.Guid,
+		Url:        item.Url,
+		Status:     historyDownloaded,
+		Filename:   filename,
+		Size:       item.Size,
+		Type:       item.Type,
+		ItemTitle:  item.ItemTitle,
+		Extras:     extras,
+		PubDate:    item.PubDate,
+		Duration:   item.Duration,
+		RecordedAt: time.Now(),
+	}
+}
+
+// MarkDeleted records that downloaded file was removed, item is still known
+func (h *History) MarkDeleted(e *HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e.Status = historyDeleted
+}
+
+// MarkSeen records all enclosures of items as seen, so they are never downloaded.
+// Only items skipped by date are passed, items skipped by filter, mtype or count
+// are checked again by next sync, so changed settings can select them
+func (h *History) MarkSeen(items []*FeedItem) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, item := range items {
+		for _, enclosure := range item.Enclosures {
+			key := historyKey(item.Guid, enclosure.Url)
+			if _, ok := h.Entries[key]; ok {
+				continue
+			}
+			h.Entries[key] = &HistoryEntry{
+				Guid:       item.Guid,
+				Url:        enclosure.Url,
+				Status:     historySeen,
+				ItemTitle:  item.Title,
+				PubDate:    item.PubDate,
+				RecordedAt: time.Now(),
+			}
+		}
+	}
+}
+
+// ForgetSeen removes seen entries, downloaded entries are kept
+func (h *History) ForgetSeen() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, e := range h.Entries {
+		if e.Status == historySeen {
+			delete(h.Entries, key)
+		}
+	}
+}
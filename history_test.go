@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestHistory(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testhistory")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	path := filepath.Join(tmpDir, "cache", "podcast.json")
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatal("Failed to load missing history", err)
+	}
+	assert.Equal(t, 0, h.Len(), "History should be empty")
+
+	item := &DownloadItem{Guid: "guid-1", Url: "http://localhost/1.mp3", ItemTitle: "First", Size: 10}
+	h.MarkDownloaded(item, "/data/1.mp3")
+	if err = h.Save(); err != nil {
+		t.Fatal("Failed to save history", err)
+	}
+
+	h, err = LoadHistory(path)
+	if err != nil {
+		t.Fatal("Failed to load history", err)
+	}
+	assert.Equal(t, 1, h.Len(), "History length")
+	assert.True(t, h.Known("guid-1", "http://localhost/1.mp3"), "Downloaded item is not known")
+	assert.False(t, h.Known("guid-2", "http://localhost/1.mp3"), "Other guid must not be known")
+	assert.Equal(t, "/data/1.mp3", h.Downloaded()[0].Filename, "HistoryEntry.Filename is incorrect")
+
+	h.Entries[historyKey("guid-2", "http://localhost/2.mp3")] = &HistoryEntry{Status: historySeen}
+	h.ForgetSeen()
+	assert.Equal(t, 1, h.Len(), "Seen entries were not removed")
+	assert.Equal(t, 1, len(h.Downloaded()), "Downloaded entries must be kept")
+}
+
+func TestMarkSeenSkippedByDate(t *testing.T) {
+	lastSynced := time.Date(2016, 8, 11, 0, 0, 0, 0, time.UTC)
+	channel := &FeedChannel{Items: []*FeedItem{
+		{Guid: "new", PubDate: lastSynced.Add(time.Hour), Title: "New bonus",
+			Enclosures: []*FeedEnclosure{{Url: "http://localhost/new.mp3"}}},
+		{Guid: "filtered", PubDate: lastSynced.Add(time.Hour), Title: "New",
+			Enclosures: []*FeedEnclosure{{Url: "http://localhost/filtered.mp3"}}},
+		{Guid: "old", PubDate: lastSynced.Add(-time.Hour), Title: "Old bonus",
+			Enclosures: []*FeedEnclosure{{Url: "http://localhost/old.mp3"}}},
+	}}
+	h := &History{Entries: map[string]*HistoryEntry{}}
+	filter := &Filter{Count: -1, LastSynced: lastSynced, History: h, Filter: "'bonus' in {{ItemTitle}}"}
+	items, err := filter.FilterItems(channel)
+	if assert.NoError(t, err) && assert.Len(t, items, 1) {
+		assert.Equal(t, "new", items[0].Guid)
+	}
+
+	h.MarkSeen(filter.SkippedByDate(channel))
+	assert.True(t, h.Known("old", "http://localhost/old.mp3"), "item older than last sync should be seen")
+	assert.False(t, h.Known("filtered", "http://localhost/filtered.mp3"), "filtered item should be checked again")
+
+	// changed filter selects item skipped before
+	filter = &Filter{Count: -1, LastSynced: lastSynced, History: h, Filter: "'New' in {{ItemTitle}}"}
+	items, _ = filter.FilterItems(channel)
+	assert.Len(t, items, 2)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// hookEnvPrefix is prefix of environment variables passed to hooks
+const hookEnvPrefix = "PODDL_"
+
+// hookOutputLimit limits hook output included in error
+const hookOutputLimit = 512
+
+// hookEnvValueLimit limits length of environment variable passed to hook,
+// exec fails, if one is longer than 128KiB, e.g. full html description of item
+const hookEnvValueLimit = 32 * 1024
+
+// tokenEnvName converts token name to environment variable name: ItemTitle -> PODDL_ITEM_TITLE
+func tokenEnvName(token string) string {
+	var b bytes.Buffer
+	b.WriteString(hookEnvPrefix)
+	for i, r := range token {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// hookEnv returns environment of current process with tokens added,
+// long values are truncated to hookEnvValueLimit
+func hookEnv(tokens map[string]string) []string {
+	env := os.Environ()
+	for _, token := range sortedKeys(tokens) {
+		value := tokens[token]
+		if len(value) > hookEnvValueLimit {
+			// do not split utf-8 sequence
+			n := hookEnvValueLimit
+			for n > 0 && !utf8.RuneStart(value[n]) {
+				n--
+			}
+			value = value[:n]
+		}
+		env = append(env, tokenEnvName(token)+"="+value)
+	}
+	return env
+}
+
+// runHook runs command by shell, tokens are passed as environment variables.
+// Command is killed if it runs longer than timeout, 0 means no timeout
+func runHook(command string, tokens map[string]string, timeout time.Duration) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = hookEnv(tokens)
+	// output goes to file, not to pipe, so children of killed hook cannot block waiting
+	out, err := ioutil.TempFile("", "gopoddl-hook")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	defer out.Close()
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	err = cmd.Run()
+	content, _ := ioutil.ReadFile(out.Name())
+	log.Debugf("hook: %s: %s", command, content)
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("hook '%s' timed out after %s", command, timeout)
+	}
+	if err != nil {
+		output := strings.TrimSpace(string(content))
+		if len(output) > hookOutputLimit {
+			output = "..." + output[len(output)-hookOutputLimit:]
+		}
+		if output != "" {
+			return fmt.Errorf("hook '%s' failed: %v: %s", command, err, output)
+		}
+		return fmt.Errorf("hook '%s' failed: %v", command, err)
+	}
+	return nil
+}
+
+// itemHookTokens returns item tokens with downloaded file details added
+func itemHookTokens(item *DownloadItem) map[string]string {
+	tokens := map[string]string{}
+	for k, v := range item.Tokens {
+		tokens[k] = v
+	}
+	tokens["ItemPath"] = item.Path
+	tokens["ItemPubTime"] = item.PubDate.Format(time.RFC3339)
+	if info, err := os.Stat(item.Path); err == nil {
+		tokens["ItemSize"] = fmt.Sprint(info.Size())
+	}
+	return tokens
+}
+
+// runDownloadHook runs on-download hook of podcast for downloaded item
+func runDownloadHook(podcast *Podcast, item *DownloadItem) error {
+	return runHook(podcast.OnDownload, itemHookTokens(item), podcast.HookTimeout)
+}
+
+// runCompletionHooks runs on-podcast-complete hooks of podcasts with downloaded or failed items
+// and on-sync-complete hook, hook errors are only reported
+func runCompletionHooks(synced []*Podcast, titles map[*Podcast]string, allReqs []*podcastRequests, notDownloaded []*downloadStatus, settings *GlobalSettings) {
+	failedCount := map[*Podcast]int{}
+	for _, status := range notDownloaded {
+		failedCount[status.Podcast]++
+	}
+	requested := map[*Podcast]int{}
+	for _, reqs := range allReqs {
+		requested[reqs.Podcast] += len(reqs.Items)
+	}
+
+	totalDownloaded := 0
+	for _, podcast := range synced {
+		downloaded := requested[podcast] - failedCount[podcast]
+		totalDownloaded += downloaded
+		if podcast.OnPodcastComplete == "" || requested[podcast] == 0 {
+			continue
+		}
+		tokens := map[string]string{
+			"Name":         podcast.Name,
+			"Title":        titles[podcast],
+			"DownloadPath": podcast.DownloadPath,
+			"Downloaded":   fmt.Sprint(downloaded),
+			"Failed":       fmt.Sprint(failedCount[podcast]),
+			"CurrentDate":  time.Now().Format(podcast.DateFormat),
+		}
+		if err := runHook(podcast.OnPodcastComplete, tokens, podcast.HookTimeout); err != nil {
+			log.Warnf("%s: %v", podcast.Name, err)
+		}
+	}
+
+	if settings.OnSyncComplete == "" {
+		return
+	}
+	tokens := map[string]string{
+		"Podcasts":   fmt.Sprint(len(synced)),
+		"Downloaded": fmt.Sprint(totalDownloaded),
+		"Failed":     fmt.Sprint(len(notDownloaded)),
+	}
+	if err := runHook(settings.OnSyncComplete, tokens, settings.HookTimeout); err != nil {
+		log.Warn(err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestTokenEnvName(t *testing.T) {
+	assert.Equal(t, "PODDL_ITEM_TITLE", tokenEnvName("ItemTitle"))
+	assert.Equal(t, "PODDL_ITEM_FILE_NAME", tokenEnvName("ItemFileName"))
+	assert.Equal(t, "PODDL_NAME", tokenEnvName("Name"))
+}
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use sh")
+	}
+	tmpDir, err := ioutil.TempDir("", "testhooks")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	itemPath := filepath.Join(tmpDir, "episode.mp3")
+	ioutil.WriteFile(itemPath, []byte("audio"), 0666)
+	item := &DownloadItem{
+		Path:    itemPath,
+		PubDate: time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tokens:  map[string]string{"ItemTitle": "It's \"quoted\"", "Name": "show"},
+	}
+	outPath := filepath.Join(tmpDir, "out.txt")
+	podcast := &Podcast{}
+	podcast.OnDownload = `echo "$PODDL_NAME|$PODDL_ITEM_TITLE|$PODDL_ITEM_SIZE|$PODDL_ITEM_PUB_TIME|$PODDL_ITEM_PATH" > ` + outPath
+	assert.NoError(t, runDownloadHook(podcast, item))
+	out, _ := ioutil.ReadFile(outPath)
+	assert.Equal(t, "show|It's \"quoted\"|5|2016-01-02T03:04:05Z|"+itemPath+"\n", string(out))
+
+	// long description does not break exec
+	item.Tokens["ItemDescription"] = strings.Repeat("ä", 100*1024)
+	podcast.OnDownload = `printf %s "$PODDL_ITEM_DESCRIPTION" > ` + outPath
+	assert.NoError(t, runDownloadHook(podcast, item))
+	out, _ = ioutil.ReadFile(outPath)
+	assert.Equal(t, strings.Repeat("ä", hookEnvValueLimit/2), string(out))
+
+	err = runHook("echo broken >&2; exit 3", nil, time.Minute)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "broken")
+	}
+
+	err = runHook("sleep 5", nil, 100*time.Millisecond)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "timed out")
+	}
+}
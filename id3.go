@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"strconv"
+	"unicode/utf16"
+)
+
+const (
+	id3HeaderLen  = 10
+	id3PaddingLen = 1024 // free space for future tag changes
+)
+
+type id3Frame struct {
+	id    string
+	flags [2]byte
+	data  []byte
+}
+
+// syncsafe integer: 7 bits per byte
+func readSyncsafe(b []byte) int {
+	return int(b[0]&0x7F)<<21 | int(b[1]&0x7F)<<14 | int(b[2]&0x7F)<<7 | int(b[3]&0x7F)
+}
+
+func putSyncsafe(b []byte, n int) {
+	b[0] = byte(n>>21) & 0x7F
+	b[1] = byte(n>>14) & 0x7F
+	b[2] = byte(n>>7) & 0x7F
+	b[3] = byte(n) & 0x7F
+}
+
+// readID3Tag reads frames of existing ID3v2 tag, returns tag version and tag length in file.
+// Frames are kept only for version 2.3 and 2.4 tags without unsynchronisation
+func readID3Tag(r io.Reader) (version byte, frames []*id3Frame, tagLen int64, err error) {
+	header := make([]byte, id3HeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[0:3]) != "ID3" {
+		return 0, nil, 0, nil // no tag
+	}
+	version = header[3]
+	flags := header[5]
+	size := readSyncsafe(header[6:10])
+	tagLen = int64(id3HeaderLen + size)
+	if version == 4 && flags&0x10 != 0 { // footer
+		tagLen += id3HeaderLen
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, 0, err
+	}
+	if (version != 3 && version != 4) || flags&0x80 != 0 {
+		return 0, nil, tagLen, nil // frames cannot be kept
+	}
+
+	pos := 0
+	if flags&0x40 != 0 && len(data) >= 4 { // extended header
+		if version == 3 {
+			pos = 4 + int(binary.BigEndian.Uint32(data[0:4]))
+		} else {
+			pos = readSyncsafe(data[0:4])
+		}
+	}
+	for pos+id3HeaderLen <= len(data) && data[pos] != 0 {
+		var frameLen int
+		if version == 4 {
+			frameLen = readSyncsafe(data[pos+4 : pos+8])
+		} else {
+			frameLen = int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		}
+		end := pos + id3HeaderLen + frameLen
+		if frameLen < 0 || end > len(data) {
+			break // broken frame, ignore rest of tag
+		}
+		frame := &id3Frame{id: string(data[pos : pos+4]), data: data[pos+id3HeaderLen : end]}
+		copy(frame.flags[:], data[pos+8:pos+10])
+		frames = append(frames, frame)
+		pos = end
+	}
+	return version, frames, tagLen, nil
+}
+
+// id3Text encodes text frame data: UTF-8 for v2.4, UTF-16 with BOM for v2.3
+func id3Text(version byte, s string) []byte {
+	if version == 4 {
+		return append([]byte{0x03}, s...)
+	}
+	return append([]byte{0x01}, utf16WithBOM(s)...)
+}
+
+func utf16WithBOM(s string) []byte {
+	b := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+// id3Comment encodes COMM frame with empty description
+func id3Comment(version byte, s string) []byte {
+	if version == 4 {
+		b := append([]byte{0x03}, "eng"...)
+		b = append(b, 0x00)
+		return append(b, s...)
+	}
+	b := append([]byte{0x01}, "eng"...)
+	b = append(b, utf16WithBOM("")...)
+	b = append(b, 0x00, 0x00)
+	return append(b, utf16WithBOM(s)...)
+}
+
+// buildID3Frames returns frames for tags, empty tags are skipped
+func buildID3Frames(version byte, tags *mediaTags) []*id3Frame {
+	frames := []*id3Frame{}
+	addText := func(id, value string) {
+		if value != "" {
+			frames = append(frames, &id3Frame{id: id, data: id3Text(version, value)})
+		}
+	}
+	addText("TPE1", tags.Artist)
+	addText("TALB", tags.Album)
+	addText("TIT2", tags.Title)
+	addText("TCON", tags.Genre)
+	if tags.Track > 0 {
+		addText("TRCK", strconv.Itoa(tags.Track))
+	}
+	if version == 4 {
+		addText("TDRC", tags.Date)
+	} else if len(tags.Date) >= 4 {
+		addText("TYER", tags.Date[0:4])
+	}
+	if tags.Comment != "" {
+		frames = append(frames, &id3Frame{id: "COMM", data: id3Comment(version, tags.Comment)})
+	}
+	return frames
+}
+
+// writeID3Tags writes tags to ID3v2 tag of file, other frames of existing tag are kept
+func writeID3Tags(path string, tags *mediaTags) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	version, oldFrames, tagLen, err := readID3Tag(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if version != 3 {
+		version = 4
+	}
+
+	frames := buildID3Frames(version, tags)
+	replaced := map[string]bool{}
+	for _, frame := range frames {
+		replaced[frame.id] = true
+	}
+	if replaced["TDRC"] || replaced["TYER"] {
+		replaced["TDRC"], replaced["TYER"], replaced["TDAT"], replaced["TIME"] = true, true, true, true
+	}
+	for _, frame := range oldFrames {
+		if !replaced[frame.id] {
+			frames = append(frames, frame)
+		}
+	}
+
+	body := []byte{}
+	for _, frame := range frames {
+		header := make([]byte, id3HeaderLen)
+		copy(header[0:4], frame.id)
+		if version == 4 {
+			putSyncsafe(header[4:8], len(frame.data))
+		} else {
+			binary.BigEndian.PutUint32(header[4:8], uint32(len(frame.data)))
+		}
+		copy(header[8:10], frame.flags[:])
+		body = append(body, header...)
+		body = append(body, frame.data...)
+	}
+	body = append(body, make([]byte, id3PaddingLen)...)
+
+	tag := []byte{'I', 'D', '3', version, 0, 0, 0, 0, 0, 0}
+	putSyncsafe(tag[6:10], len(body))
+	tag = append(tag, body...)
+	return replaceFileRange(path, 0, tagLen, tag)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoPublicBaseUrl is returned if local feed cannot be built without public-base-url
+var ErrNoPublicBaseUrl = errors.New("public-base-url is not set")
+
+// RSS 2.0 document of downloaded items
+type localFeed struct {
+	XMLName xml.Name          `xml:"rss"`
+	Version string            `xml:"version,attr"`
+	Channel *localFeedChannel `xml:"channel"`
+}
+
+type localFeedChannel struct {
+	Title         string           `xml:"title"`
+	Link          string           `xml:"link"`
+	Description   string           `xml:"description"`
+	Language      string           `xml:"language,omitempty"`
+	LastBuildDate string           `xml:"lastBuildDate"`
+	Generator     string           `xml:"generator"`
+	Image         *localFeedImage  `xml:"image,omitempty"`
+	Items         []*localFeedItem `xml:"item"`
+}
+
+type localFeedImage struct {
+	Url   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type localFeedItem struct {
+	Title       string             `xml:"title"`
+	Description string             `xml:"description,omitempty"`
+	Guid        localFeedGuid      `xml:"guid"`
+	PubDate     string             `xml:"pubDate,omitempty"`
+	Enclosure   localFeedEnclosure `xml:"enclosure"`
+
+	pubDate time.Time // for sorting
+}
+
+type localFeedGuid struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type localFeedEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// publicUrl builds url of downloaded file, file path relative to download path is appended to base url
+func publicUrl(baseUrl, downloadPath, filePath string) (string, error) {
+	rel, err := filepath.Rel(downloadPath, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", errors.New("file is outside of download path: " + filePath)
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.TrimSuffix(baseUrl, "/") + "/" + strings.Join(parts, "/"), nil
+}
+
+// media types of well known podcast file extensions
+var extMediaType = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".m4b":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/opus",
+	".wav":  "audio/wav",
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+}
+
+// fileMediaType returns media type of downloaded file by its extension
+func fileMediaType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if mediaType, ok := extMediaType[ext]; ok {
+		return mediaType
+	}
+	if mediaType := mime.TypeByExtension(ext); mediaType != "" {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
+
+// buildLocalFeed builds feed of downloaded files, which still exist.
+// Channel title, image and item descriptions are taken from original channel, if it is known
+func buildLocalFeed(podcast *Podcast, original *FeedChannel, history *History) (*localFeedChannel, error) {
+	if podcast.PublicBaseUrl == "" {
+		return nil, ErrNoPublicBaseUrl
+	}
+	downloadPath := podcast.DownloadPath
+
+	channel := &localFeedChannel{
+		Title:         podcast.Name,
+		Link:          podcast.PublicBaseUrl,
+		Description:   podcast.Name,
+		LastBuildDate: time.Now().Format(time.RFC1123Z),
+		Generator:     "gopoddl",
+	}
+	descriptions := map[string]string{}
+	if original != nil {
+		channel.Title = original.Title
+		channel.Language = original.Language
+		if original.Description != "" {
+			channel.Description = original.Description
+		}
+		if original.Link != "" {
+			channel.Link = original.Link
+		}
+		if original.ImageUrl != "" {
+			channel.Image = &localFeedImage{Url: original.ImageUrl, Title: channel.Title, Link: channel.Link}
+		}
+		for _, item := range original.Items {
+			for _, enclosure := range item.Enclosures {
+				descriptions[historyKey(item.Guid, enclosure.Url)] = item.Description
+			}
+		}
+	}
+
+	for _, e := range history.Downloaded() {
+		info, err := os.Stat(e.Filename)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		enclosureUrl, err := publicUrl(podcast.PublicBaseUrl, downloadPath, e.Filename)
+		if err != nil {
+			log.Warnf("%s: %v", podcast.Name, err)
+			continue
+		}
+		mediaType := e.Type
+		if mediaType == "" {
+			mediaType = fileMediaType(e.Filename)
+		}
+		guid := e.Guid
+		if guid == "" {
+			guid = e.Url
+		}
+		item := &localFeedItem{
+			Title:       e.ItemTitle,
+			Description: descriptions[historyKey(e.Guid, e.Url)],
+			Guid:        localFeedGuid{IsPermaLink: "false", Value: guid},
+			Enclosure:   localFeedEnclosure{Url: enclosureUrl, Length: info.Size(), Type: mediaType},
+			pubDate:     entryDate(e),
+		}
+		if !item.pubDate.IsZero() {
+			item.PubDate = item.pubDate.Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, item)
+	}
+	sortLocalFeedItems(channel.Items)
+	return channel, nil
+}
+
+// sortLocalFeedItems sorts items from newest to oldest
+func sortLocalFeedItems(items []*localFeedItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].pubDate.After(items[j].pubDate)
+	})
+}
+
+// mergeLocalFeeds merges feeds of podcasts to one feed, item titles are prefixed by channel title
+func mergeLocalFeeds(channels []*localFeedChannel, baseUrl string) *localFeedChannel {
+	merged := &localFeedChannel{
+		Title:         "gopoddl",
+		Link:          baseUrl,
+		Description:   "Downloaded episodes of " + strconv.Itoa(len(channels)) + " podcasts",
+		LastBuildDate: time.Now().Format(time.RFC1123Z),
+		Generator:     "gopoddl",
+	}
+	for _, channel := range channels {
+		for _, item := range channel.Items {
+			mergedItem := *item
+			mergedItem.Title = channel.Title + ": " + item.Title
+			merged.Items = append(merged.Items, &mergedItem)
+		}
+	}
+	sortLocalFeedItems(merged.Items)
+	return merged
+}
+
+// writeLocalFeed writes RSS 2.0 feed to file, file is replaced atomically
+func writeLocalFeed(path string, channel *localFeedChannel) error {
+	content, err := xml.MarshalIndent(&localFeed{Version: "2.0", Channel: channel}, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append([]byte(xml.Header), content...)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, append(content, '\n'), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// localFeedPath returns path of podcast feed, download path is used if dir is empty
+func localFeedPath(podcast *Podcast, dir string) string {
+	if dir == "" {
+		dir = podcast.DownloadPath
+	}
+	return filepath.Join(expandPath(dir), sanitizeFileName(podcast.Name)+".xml")
+}
+
+// writeLocalFeeds writes feed per podcast to dir and merged feed of all podcasts, if mergedPath is set.
+// Original feed is downloaded to get channel info, feed is written without it if download fails
+func writeLocalFeeds(podcasts []*Podcast, dir, mergedPath string) error {
+	channels := []*localFeedChannel{}
+	baseUrl := ""
+	for _, podcast := range podcasts {
+		history, err := LoadHistory(cfg.HistoryPath(podcast))
+		if err != nil {
+			return err
+		}
+		original, _, err := getFeed(podcast, false)
+		if err != nil {
+			log.Warnf("%s: failed to get feed: %v", podcast.Name, err)
+		}
+
+		channel, err := buildLocalFeed(podcast, original, history)
+		if err != nil {
+			log.Warnf("%s: %v", podcast.Name, err)
+			continue
+		}
+		path := localFeedPath(podcast, dir)
+		if err := writeLocalFeed(path, channel); err != nil {
+			return err
+		}
+		log.Printf("* [%s] %d items written to %s", podcast.Name, len(channel.Items), path)
+		channels = append(channels, channel)
+		if baseUrl == "" {
+			baseUrl = podcast.PublicBaseUrl
+		}
+	}
+
+	if mergedPath == "" {
+		return nil
+	}
+	merged := mergeLocalFeeds(channels, baseUrl)
+	if err := writeLocalFeed(expandPath(mergedPath), merged); err != nil {
+		return err
+	}
+	log.Printf("* %d items written to %s", len(merged.Items), expandPath(mergedPath))
+	return nil
+}
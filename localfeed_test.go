@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestPublicUrl(t *testing.T) {
+	u, err := publicUrl("http://host/podcasts/", "/data", "/data/My Show/ep #1.mp3")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://host/podcasts/My%20Show/ep%20%231.mp3", u)
+
+	_, err = publicUrl("http://host", "/data", "/other/ep.mp3")
+	assert.Error(t, err)
+}
+
+func TestBuildLocalFeed(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testlocalfeed")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	podcast := &Podcast{Name: "show"}
+	podcast.DownloadPath = tmpDir
+	_, err = buildLocalFeed(podcast, nil, &History{})
+	assert.Equal(t, ErrNoPublicBaseUrl, err)
+	podcast.PublicBaseUrl = "http://host/podcasts"
+
+	history, _ := LoadHistory(filepath.Join(tmpDir, "history.json"))
+	guid := "guid-1"
+	for i, name := range []string{"old.mp3", "new.m4a", "removed.mp3"} {
+		path := filepath.Join(tmpDir, name)
+		if name != "removed.mp3" {
+			ioutil.WriteFile(path, []byte("audio"), 0666)
+		}
+		item := &DownloadItem{Url: "http://orig/" + name, ItemTitle: name, PubDate: time.Date(2016, 1, 1+i, 0, 0, 0, 0, time.UTC)}
+		if i == 0 {
+			item.Guid = guid
+			item.Type = "audio/mpeg"
+		}
+		history.MarkDownloaded(item, path)
+	}
+	original := &FeedChannel{
+		Title:       "Show",
+		Description: "About show",
+		ImageUrl:    "http://orig/cover.jpg",
+		Items: []*FeedItem{{
+			Guid:        guid,
+			Description: "First episode",
+			Enclosures:  []*FeedEnclosure{{Url: "http://orig/old.mp3"}},
+		}},
+	}
+
+	channel, err := buildLocalFeed(podcast, original, history)
+	assert.NoError(t, err)
+	assert.Equal(t, "Show", channel.Title)
+	assert.Equal(t, "http://orig/cover.jpg", channel.Image.Url)
+	if !assert.Len(t, channel.Items, 2) {
+		return
+	}
+	assert.Equal(t, "new.m4a", channel.Items[0].Title)
+	assert.Equal(t, "http://host/podcasts/new.m4a", channel.Items[0].Enclosure.Url)
+	assert.Equal(t, "audio/mp4", channel.Items[0].Enclosure.Type)
+	assert.Equal(t, "http://orig/new.m4a", channel.Items[0].Guid.Value)
+	assert.Equal(t, "First episode", channel.Items[1].Description)
+	assert.Equal(t, "audio/mpeg", channel.Items[1].Enclosure.Type)
+	assert.Equal(t, int64(5), channel.Items[1].Enclosure.Length)
+	assert.Equal(t, "Fri, 01 Jan 2016 00:00:00 +0000", channel.Items[1].PubDate)
+
+	// written feed is valid xml
+	path := localFeedPath(podcast, "")
+	assert.NoError(t, writeLocalFeed(path, mergeLocalFeeds([]*localFeedChannel{channel}, podcast.PublicBaseUrl)))
+	content, _ := ioutil.ReadFile(path)
+	parsed := &localFeed{}
+	assert.NoError(t, xml.Unmarshal(content, parsed))
+	assert.Equal(t, "2.0", parsed.Version)
+	assert.Equal(t, "Show: new.m4a", parsed.Channel.Items[0].Title)
+	assert.Equal(t, "false", parsed.Channel.Items[0].Guid.IsPermaLink)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned if other instance holds lock file
+var ErrLocked = errors.New("other gopoddl instance is running")
+
+// lockFile prevents parallel runs, which would overwrite config and history of each other
+type lockFile struct {
+	path string
+}
+
+// acquireLock creates lock file with pid of current process,
+// lock file of process, which does not exist anymore, is taken over
+func acquireLock(path string) (*lockFile, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return &lockFile{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		content, _ := ioutil.ReadFile(path)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err == nil && processExists(pid) {
+			return nil, fmt.Errorf("%s (pid %d, lock file %s)", ErrLocked, pid, path)
+		}
+		log.Warnf("Removing stale lock file %s", path)
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%s (lock file %s)", ErrLocked, path)
+}
+
+// release removes lock file
+func (l *lockFile) release() error {
+	return os.Remove(l.path)
+}
+
+// lockPath returns path of lock file for config
+func lockPath(configPath string) string {
+	return configPath + ".lock"
+}
+
+// withConfigLock runs fn holding lock of config file
+func withConfigLock(fn func() error) error {
+	lock, err := acquireLock(lockPath(cfg.configPath))
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	return fn()
+}
@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"syscall"
+)
+
+const processQueryLimitedInformation = 0x1000
+
+// processExists returns true if process with pid is running
+func processExists(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	const stillActive = 259
+	return syscall.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
@@ -10,7 +10,8 @@ import (
 var (
 	progName = "gopoddl"
 	cfg      *Config
-	log      *logsip.Logger
+	log      = logsip.Default()
+	output   = &Output{format: outputText, w: os.Stdout}
 )
 
 // entry point
@@ -22,7 +23,16 @@ func main() {
 	app.Usage = "Podcast downloader"
 	app.Before = func(c *cli.Context) (err error) {
 
-		log = logsip.Default()
+		if output, err = NewOutput(c.GlobalString("output"), os.Stdout); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+
+		// keep stdout clean for machine readable output
+		if output.IsText() {
+			log = logsip.Default()
+		} else {
+			log = logsip.New(os.Stderr)
+		}
 		log.DebugMode = c.Bool("debug")
 
 		// skip rest of function for init
@@ -39,8 +49,12 @@ func main() {
 			os.Exit(0)
 		}
 
-		// Load files
-		if cfg, err = NewConfig(cfgFile); err != nil {
+		// Load files, 'validate' reports problems of config itself
+		load := NewConfig
+		if c.Args().First() == "validate" {
+			load = loadConfig
+		}
+		if cfg, err = load(cfgFile); err != nil {
 			log.Fatal(err)
 			os.Exit(1)
 		}
@@ -55,6 +69,12 @@ func main() {
 			Value:  "~/.gopoddl_conf.ini",
 			Usage:  "path to config file",
 		},
+		cli.StringFlag{
+			Name:   "output, o",
+			EnvVar: "PODDL_OUTPUT",
+			Value:  outputText,
+			Usage:  "output format: text, json or ndjson",
+		},
 		cli.BoolFlag{
 			Name:   "debug, d",
 			EnvVar: "PODDL_DEBUG",
@@ -62,10 +82,23 @@ func main() {
 		},
 	}
 
+	// commands failed by exit error have to write collected records too
+	cli.OsExiter = func(code int) {
+		if err := output.Flush(); err != nil {
+			log.Warn(err)
+		}
+		os.Exit(code)
+	}
+
 	app.Commands = []cli.Command{
 		cmdInit(), cmdList(), cmdAdd(), cmdRemove(),
-		cmdReset(), cmdCheck(), cmdSync(),
+		cmdImport(), cmdExport(),
+		cmdReset(), cmdCheck(), cmdSync(), cmdPrune(),
+		cmdFeed(), cmdServe(), cmdDaemon(), cmdValidate(),
 	}
 
 	app.Run(os.Args)
+	if err := output.Flush(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// mp4Atom is atom header position in file or buffer
+type mp4Atom struct {
+	typ       string
+	offset    int64 // atom start
+	headerLen int64
+	size      int64 // including header
+}
+
+var errMP4NoMoov = errors.New("tags: mp4 file has no moov atom")
+
+// readMP4Atoms reads top level atoms of file
+func readMP4Atoms(r io.ReadSeeker) ([]*mp4Atom, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	atoms := []*mp4Atom{}
+	header := make([]byte, 16)
+	for offset := int64(0); offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, header[0:8]); err != nil {
+			return nil, err
+		}
+		atom := &mp4Atom{typ: string(header[4:8]), offset: offset, headerLen: 8}
+		atom.size = int64(binary.BigEndian.Uint32(header[0:4]))
+		switch atom.size {
+		case 0: // atom lasts to end of file
+			atom.size = end - offset
+		case 1: // 64-bit size
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, err
+			}
+			atom.size = int64(binary.BigEndian.Uint64(header[8:16]))
+			atom.headerLen = 16
+		}
+		if atom.size < atom.headerLen || offset+atom.size > end {
+			return nil, errors.New("tags: broken mp4 atom " + atom.typ)
+		}
+		atoms = append(atoms, atom)
+		offset += atom.size
+	}
+	return atoms, nil
+}
+
+// parseMP4Children parses atoms stored in data
+func parseMP4Children(data []byte) []*mp4Atom {
+	atoms := []*mp4Atom{}
+	for offset := int64(0); offset+8 <= int64(len(data)); {
+		atom := &mp4Atom{typ: string(data[offset+4 : offset+8]), offset: offset, headerLen: 8}
+		atom.size = int64(binary.BigEndian.Uint32(data[offset : offset+4]))
+		switch atom.size {
+		case 0:
+			atom.size = int64(len(data)) - offset
+		case 1:
+			if offset+16 > int64(len(data)) {
+				return atoms
+			}
+			atom.size = int64(binary.BigEndian.Uint64(data[offset+8 : offset+16]))
+			atom.headerLen = 16
+		}
+		if atom.size < atom.headerLen || offset+atom.size > int64(len(data)) {
+			return atoms
+		}
+		atoms = append(atoms, atom)
+		offset += atom.size
+	}
+	return atoms
+}
+
+func makeMP4Atom(typ string, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(8+len(payload)))
+	copy(b[4:8], typ)
+	return append(b, payload...)
+}
+
+// replaceMP4Child replaces or appends child atom of container payload
+func replaceMP4Child(payload []byte, typ string, child []byte) []byte {
+	for _, atom := range parseMP4Children(payload) {
+		if atom.typ == typ {
+			out := append([]byte{}, payload[:atom.offset]...)
+			out = append(out, child...)
+			return append(out, payload[atom.offset+atom.size:]...)
+		}
+	}
+	return append(append([]byte{}, payload...), child...)
+}
+
+// findMP4Child returns payload of child atom
+func findMP4Child(payload []byte, typ string) ([]byte, bool) {
+	for _, atom := range parseMP4Children(payload) {
+		if atom.typ == typ {
+			return payload[atom.offset+atom.headerLen : atom.offset+atom.size], true
+		}
+	}
+	return nil, false
+}
+
+// mp4TextItem makes ilst item with UTF-8 data atom
+func mp4TextItem(typ, value string) []byte {
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint32(data[0:4], 1) // UTF-8
+	return makeMP4Atom(typ, makeMP4Atom("data", append(data, value...)))
+}
+
+// mp4TrackItem makes trkn item, track number without total
+func mp4TrackItem(track int) []byte {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint16(data[10:12], uint16(track))
+	return makeMP4Atom("trkn", makeMP4Atom("data", data))
+}
+
+// buildMP4Items updates ilst payload with tags, other items are kept
+func buildMP4Items(ilst []byte, tags *mediaTags) []byte {
+	items := []struct {
+		typ   string
+		value string
+	}{
+		{"\xa9ART", tags.Artist},
+		{"\xa9alb", tags.Album},
+		{"\xa9nam", tags.Title},
+		{"\xa9day", tags.Date},
+		{"\xa9cmt", tags.Comment},
+		{"\xa9gen", tags.Genre},
+	}
+	for _, item := range items {
+		if item.value != "" {
+			ilst = replaceMP4Child(ilst, item.typ, mp4TextItem(item.typ, item.value))
+		}
+	}
+	if tags.Track > 0 {
+		ilst = replaceMP4Child(ilst, "trkn", mp4TrackItem(tags.Track))
+	}
+	return ilst
+}
+
+// buildMP4Moov returns moov atom with tags stored in moov.udta.meta.ilst
+func buildMP4Moov(moov []byte, tags *mediaTags) []byte {
+	udta, _ := findMP4Child(moov, "udta")
+	meta, ok := findMP4Child(udta, "meta")
+	if !ok || len(meta) < 4 {
+		hdlr := make([]byte, 25)
+		copy(hdlr[8:12], "mdir")
+		copy(hdlr[12:16], "appl")
+		meta = append(make([]byte, 4), makeMP4Atom("hdlr", hdlr)...)
+	}
+	ilst, _ := findMP4Child(meta[4:], "ilst")
+	ilst = buildMP4Items(append([]byte{}, ilst...), tags)
+
+	meta = append(append([]byte{}, meta[:4]...), replaceMP4Child(meta[4:], "ilst", makeMP4Atom("ilst", ilst))...)
+	udta = replaceMP4Child(udta, "meta", makeMP4Atom("meta", meta))
+	return makeMP4Atom("moov", replaceMP4Child(moov, "udta", makeMP4Atom("udta", udta)))
+}
+
+// shiftMP4ChunkOffsets adds delta to stco/co64 chunk offsets greater than from,
+// media data stored after moov moves when moov size changes
+func shiftMP4ChunkOffsets(container []byte, from int64, delta int64) {
+	for _, atom := range parseMP4Children(container) {
+		payload := container[atom.offset+atom.headerLen : atom.offset+atom.size]
+		switch atom.typ {
+		case "trak", "mdia", "minf", "stbl":
+			shiftMP4ChunkOffsets(payload, from, delta)
+		case "stco":
+			if len(payload) < 8 {
+				continue
+			}
+			count := int(binary.BigEndian.Uint32(payload[4:8]))
+			for i := 0; i < count && 8+i*4+4 <= len(payload); i++ {
+				b := payload[8+i*4 : 8+i*4+4]
+				if v := int64(binary.BigEndian.Uint32(b)); v > from {
+					binary.BigEndian.PutUint32(b, uint32(v+delta))
+				}
+			}
+		case "co64":
+			if len(payload) < 8 {
+				continue
+			}
+			count := int(binary.BigEndian.Uint32(payload[4:8]))
+			for i := 0; i < count && 8+i*8+8 <= len(payload); i++ {
+				b := payload[8+i*8 : 8+i*8+8]
+				if v := int64(binary.BigEndian.Uint64(b)); v > from {
+					binary.BigEndian.PutUint64(b, uint64(v+delta))
+				}
+			}
+		}
+	}
+}
+
+// writeMP4Tags writes tags to iTunes style metadata of mp4 file
+func writeMP4Tags(path string, tags *mediaTags) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	atoms, err := readMP4Atoms(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	var moovAtom *mp4Atom
+	for _, atom := range atoms {
+		if atom.typ == "moov" {
+			moovAtom = atom
+		}
+	}
+	if moovAtom == nil {
+		f.Close()
+		return errMP4NoMoov
+	}
+	moov := make([]byte, moovAtom.size-moovAtom.headerLen)
+	_, err = f.ReadAt(moov, moovAtom.offset+moovAtom.headerLen)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	newMoov := buildMP4Moov(moov, tags)
+	delta := int64(len(newMoov)) - moovAtom.size
+	if delta != 0 {
+		shiftMP4ChunkOffsets(newMoov[8:], moovAtom.offset, delta)
+	}
+	return replaceFileRange(path, moovAtom.offset, moovAtom.offset+moovAtom.size, newMoov)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// opmlSettingPrefix is prefix of outline attributes with podcast settings
+const opmlSettingPrefix = "gopoddl-"
+
+type opml struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Head    opmlHead      `xml:"head"`
+	Body    []opmlOutline `xml:"body>outline"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type opmlOutline struct {
+	Type     string        `xml:"type,attr,omitempty"`
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	XMLUrl   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLUrl  string        `xml:"htmlUrl,attr,omitempty"`
+	Attrs    []xml.Attr    `xml:",any,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlPodcast is podcast subscription from OPML file
+type opmlPodcast struct {
+	Name     string
+	Url      string
+	Settings map[string]string // podcast settings from custom attributes
+}
+
+// podcastSettingKeys returns ini keys of all PodcastSettings fields
+func podcastSettingKeys() map[string]bool {
+	return iniKeys(PodcastSettings{})
+}
+
+// opmlImportKeys are settings imported from OPML attributes, hooks and path settings
+// (download-path, cache-path, separate-dir, playlist, ...) are not imported,
+// so shared OPML file cannot run commands or write files out of download path
+var opmlImportKeys = map[string]bool{
+	"filter":      true,
+	"mtype":       true,
+	"file-name":   true,
+	"date-format": true,
+	"extras":      true,
+	"tags":        true,
+	"keep-count":  true,
+	"keep-days":   true,
+	"keep-size":   true,
+}
+
+// iniKeys returns ini keys of struct fields, embedded structs are skipped
+func iniKeys(v interface{}) map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Anonymous {
+			continue
+		}
+		if key := t.Field(i).Tag.Get("ini"); key != "" && key != "-" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// readOPML returns all outlines with feed url, nested outlines are included
+func readOPML(r io.Reader) ([]*opmlPodcast, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc := new(opml)
+	if err := xml.Unmarshal(content, doc); err != nil {
+		return nil, err
+	}
+
+	podcasts := []*opmlPodcast{}
+	var walk func(outlines []opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, o := range outlines {
+			walk(o.Outlines)
+			if o.XMLUrl == "" {
+				continue
+			}
+			p := &opmlPodcast{Name: o.Title, Url: o.XMLUrl, Settings: map[string]string{}}
+			if p.Name == "" {
+				p.Name = o.Text
+			}
+			for _, attr := range o.Attrs {
+				key := strings.TrimPrefix(attr.Name.Local, opmlSettingPrefix)
+				if key != attr.Name.Local && opmlImportKeys[key] {
+					p.Settings[key] = attr.Value
+				}
+			}
+			podcasts = append(podcasts, p)
+		}
+	}
+	walk(doc.Body)
+	return podcasts, nil
+}
+
+// writeOPML writes all podcasts from config, own podcast settings are written as custom attributes
+func writeOPML(w io.Writer, c *Config) error {
+	doc := &opml{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       progName + " subscriptions",
+			DateCreated: time.Now().Format(time.RFC1123Z),
+		},
+	}
+	for _, podcast := range c.GetAllPodcasts() {
+		settings, err := c.GetPodcastOwnSettings(podcast.Name)
+		if err != nil {
+			return err
+		}
+		outline := opmlOutline{
+			Type:   "rss",
+			Text:   podcast.Name,
+			Title:  podcast.Name,
+			XMLUrl: podcast.Url,
+		}
+		for _, key := range sortedKeys(settings) {
+			outline.Attrs = append(outline.Attrs, xml.Attr{
+				Name:  xml.Name{Local: opmlSettingPrefix + key},
+				Value: settings[key],
+			})
+		}
+		doc.Body = append(doc.Body, outline)
+	}
+
+	content, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := w.Write(append(content, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestOPMLImport(t *testing.T) {
+	content := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Music">
+      <outline type="rss" text="Radio Record" xmlUrl="http://localhost/record.xml" gopoddl-mtype="video" gopoddl-unknown="1"
+        gopoddl-on-download="rm -rf ~" gopoddl-download-path="/etc" gopoddl-cache-path="/tmp"
+        gopoddl-playlist="~/.bashrc" gopoddl-separate-dir="../../.ssh"/>
+    </outline>
+    <outline type="rss" text="Text only" title="Title" xmlUrl="http://localhost/title.xml"/>
+    <outline type="link" text="No feed" htmlUrl="http://localhost/"/>
+  </body>
+</opml>`
+
+	podcasts, err := readOPML(strings.NewReader(content))
+	if err != nil {
+		t.Fatal("Failed to read OPML", err)
+	}
+	assert.Equal(t, 2, len(podcasts), "Podcasts count")
+	assert.Equal(t, "Radio Record", podcasts[0].Name)
+	assert.Equal(t, "http://localhost/record.xml", podcasts[0].Url)
+	assert.Equal(t, map[string]string{"mtype": "video"}, podcasts[0].Settings, "hooks and paths are not imported")
+	assert.Equal(t, "Title", podcasts[1].Name)
+}
+
+func TestOPMLExport(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "testconfig")
+	if err != nil {
+		t.Fatal("Failed to create tmp file", err)
+	}
+	defer os.Remove(tmpfile.Name()) // clean up
+	tmpfile.WriteString("mtype = audio\n")
+	tmpfile.Close()
+
+	savedCfg := cfg
+	defer func() { cfg = savedCfg }()
+	if cfg, err = NewConfig(tmpfile.Name()); err != nil {
+		t.Fatal("Failed to read config", err)
+	}
+	settings := map[string]string{"filter": "'Day' not in {{ItemTitle}}", "mtype": "video"}
+	if err = cfg.AddPodcastWithSettings("Radio Record", "http://localhost/rss.xml", settings); err != nil {
+		t.Fatal("Failed to add podcast", err)
+	}
+	assert.Equal(t, ErrPodacastAlreadyExist, cfg.AddPodcast("Radio Record", "http://localhost/rss.xml"))
+
+	buf := new(bytes.Buffer)
+	if err = writeOPML(buf, cfg); err != nil {
+		t.Fatal("Failed to write OPML", err)
+	}
+	podcasts, err := readOPML(buf)
+	if err != nil {
+		t.Fatal("Failed to read exported OPML", err)
+	}
+	assert.Equal(t, 1, len(podcasts), "Podcasts count")
+	assert.True(t, strings.EqualFold("Radio Record", podcasts[0].Name), "Podcast name is incorrect")
+	assert.Equal(t, settings, podcasts[0].Settings, "Settings were not exported")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// output formats, set by global --output option
+const (
+	outputText   = "text"   // colourised text for humans
+	outputJSON   = "json"   // one JSON array, printed when command (or sync of daemon) is finished
+	outputNDJSON = "ndjson" // one JSON object per line, printed immediately
+)
+
+// Output emits machine readable records, does nothing for text format
+type Output struct {
+	format  string
+	w       io.Writer
+	records []interface{}
+	flushed bool // records were written already
+}
+
+// NewOutput creates output of given format
+func NewOutput(format string, w io.Writer) (*Output, error) {
+	switch format {
+	case outputText, outputJSON, outputNDJSON:
+		return &Output{format: format, w: w, records: []interface{}{}}, nil
+	}
+	return nil, fmt.Errorf("output: unknown format: %s, use %s, %s or %s",
+		format, outputText, outputJSON, outputNDJSON)
+}
+
+// IsText returns true if output is for humans
+func (o *Output) IsText() bool {
+	return o.format == outputText
+}
+
+// Emit writes record, records of json format are collected till Flush
+func (o *Output) Emit(record interface{}) {
+	switch o.format {
+	case outputNDJSON:
+		if err := json.NewEncoder(o.w).Encode(record); err != nil {
+			log.Warnf("output: %s", err)
+		}
+	case outputJSON:
+		o.records = append(o.records, record)
+	}
+}
+
+// Flush writes collected records of json format as array, records are cleared,
+// so daemon writes array per sync. Empty array is written only if nothing was written before
+func (o *Output) Flush() error {
+	if o.format != outputJSON || (o.flushed && len(o.records) == 0) {
+		return nil
+	}
+	content, err := json.MarshalIndent(o.records, "", "  ")
+	if err != nil {
+		return err
+	}
+	o.records = []interface{}{}
+	o.flushed = true
+	_, err = o.w.Write(append(content, '\n'))
+	return err
+}
+
+// checkRecord is result of 'check' for one podcast
+type checkRecord struct {
+	Index   int             `json:"index"`
+	Podcast string          `json:"podcast"`
+	Url     string          `json:"url"`
+	Status  string          `json:"status"` // ok, not-modified or failed
+	Error   string          `json:"error,omitempty"`
+	Items   []*DownloadItem `json:"items"`
+}
+
+func newCheckRecord(podcast *Podcast, podcastList []*DownloadItem, index int, err error) *checkRecord {
+	r := &checkRecord{
+		Index:   index,
+		Podcast: podcast.Name,
+		Url:     podcast.Url,
+		Status:  "ok",
+		Items:   podcastList,
+	}
+	if r.Items == nil {
+		r.Items = []*DownloadItem{}
+	}
+	if err == ErrFeedNotModified {
+		r.Status = "not-modified"
+	} else if err != nil {
+		r.Status = "failed"
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// pruneRecord is file removed by 'prune'
+type pruneRecord struct {
+	Podcast string    `json:"podcast"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	PubDate time.Time `json:"pub-date"`
+	Reason  string    `json:"reason"`
+	DryRun  bool      `json:"dry-run,omitempty"`
+}
+
+func newPruneRecord(podcast *Podcast, item *pruneItem, dryRun bool) *pruneRecord {
+	return &pruneRecord{
+		Podcast: podcast.Name,
+		Path:    item.Entry.Filename,
+		Size:    item.Size,
+		PubDate: item.Entry.PubDate,
+		Reason:  item.Reason,
+		DryRun:  dryRun,
+	}
+}
+
+// syncEvent is event of 'sync'
+type syncEvent struct {
+	Event     string    `json:"event"` // started, retry, finished, failed or feed-failed
+	Time      time.Time `json:"time"`
+	Podcast   string    `json:"podcast"`
+	ItemTitle string    `json:"item-title,omitempty"`
+	Url       string    `json:"url"`
+	Path      string    `json:"path,omitempty"`
+	Current   int       `json:"current,omitempty"`
+	Total     int       `json:"total,omitempty"`
+	Attempt   int       `json:"attempt,omitempty"`
+	Bytes     uint64    `json:"bytes,omitempty"`
+	Duration  float64   `json:"duration-sec,omitempty"`
+	RetryIn   float64   `json:"retry-in-sec,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Warnings  []string  `json:"warnings,omitempty"`
+}
+
+func newSyncEvent(event string, status *downloadStatus) *syncEvent {
+	e := &syncEvent{
+		Event:     event,
+		Time:      time.Now(),
+		Podcast:   status.Podcast.Name,
+		ItemTitle: status.Item.ItemTitle,
+		Url:       status.Item.Url,
+		Path:      status.Item.Path,
+		Current:   status.Current,
+		Total:     status.Total,
+		Attempt:   status.Attempt,
+		RetryIn:   status.RetryIn.Seconds(),
+	}
+	if event != "started" {
+		e.Bytes = status.Response.BytesTransferred()
+		e.Duration = time.Since(status.StartedAt).Seconds()
+	}
+	if status.Response != nil && status.Response.Error != nil {
+		e.Error = status.Response.Error.Error()
+	}
+	for _, warning := range status.Warnings {
+		e.Warnings = append(e.Warnings, warning.Error())
+	}
+	return e
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestOutput(t *testing.T) {
+	_, err := NewOutput("xml", new(bytes.Buffer))
+	assert.NotNil(t, err, "unknown format should fail")
+
+	buf := new(bytes.Buffer)
+	o, _ := NewOutput(outputNDJSON, buf)
+	o.Emit(&Podcast{Name: "one"})
+	o.Emit(&Podcast{Name: "two"})
+	o.Flush()
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte("\n")), "ndjson should have one line per record")
+	assert.Contains(t, buf.String(), `"name":"one"`)
+
+	buf.Reset()
+	o, _ = NewOutput(outputJSON, buf)
+	o.Emit(newCheckRecord(&Podcast{Name: "one"}, nil, 1, ErrFeedNotModified))
+	assert.Equal(t, 0, buf.Len(), "json should be written on flush")
+	o.Flush()
+	assert.Contains(t, buf.String(), `"status": "not-modified"`)
+	assert.Contains(t, buf.String(), `"items": []`)
+
+	// next flush writes only new records
+	buf.Reset()
+	o.Flush()
+	assert.Equal(t, 0, buf.Len(), "flushed records should not be written again")
+	o.Emit(&Podcast{Name: "two"})
+	o.Flush()
+	assert.Contains(t, buf.String(), `"name": "two"`)
+	assert.NotContains(t, buf.String(), "not-modified")
+
+	buf.Reset()
+	o, _ = NewOutput(outputText, buf)
+	o.Emit(&Podcast{Name: "one"})
+	o.Flush()
+	assert.Equal(t, 0, buf.Len(), "text output should not emit records")
+}
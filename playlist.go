@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// playlistEntry is one file of playlist
+type playlistEntry struct {
+	Path     string
+	Title    string
+	PubDate  time.Time
+	Duration time.Duration // 0 if unknown
+}
+
+// playlistRelEntry returns entry with path relative to playlist dir if file is inside it,
+// title is made single line
+func playlistRelEntry(dir string, e *playlistEntry) *playlistEntry {
+	rel := *e
+	if p, err := filepath.Rel(dir, e.Path); err == nil && !strings.HasPrefix(p, "..") {
+		rel.Path = p
+	}
+	rel.Title = strings.Join(strings.Fields(e.Title), " ")
+	return &rel
+}
+
+// writePlaylist writes entries sorted by publish date to playlist file,
+// format is chosen by extension: pls for .pls, extended m3u otherwise
+func writePlaylist(path string, entries []*playlistEntry) error {
+	dir := filepath.Dir(path)
+	sorted := make([]*playlistEntry, len(entries))
+	for i, e := range entries {
+		sorted[i] = playlistRelEntry(dir, e)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].PubDate.Before(sorted[j].PubDate)
+	})
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if strings.ToLower(filepath.Ext(path)) == ".pls" {
+		writePLS(w, sorted)
+	} else {
+		writeM3U(w, sorted)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// playlistSeconds returns duration in seconds, -1 if it is unknown
+func playlistSeconds(d time.Duration) int {
+	if d <= 0 {
+		return -1
+	}
+	return int(d.Seconds() + 0.5)
+}
+
+func writeM3U(w io.Writer, entries []*playlistEntry) {
+	fmt.Fprint(w, "#EXTM3U\n")
+	for _, e := range entries {
+		if e.Title != "" || e.Duration > 0 {
+			fmt.Fprintf(w, "#EXTINF:%d,%s\n", playlistSeconds(e.Duration), e.Title)
+		}
+		fmt.Fprintf(w, "%s\n", e.Path)
+	}
+}
+
+func writePLS(w io.Writer, entries []*playlistEntry) {
+	fmt.Fprint(w, "[playlist]\n")
+	for i, e := range entries {
+		fmt.Fprintf(w, "File%d=%s\n", i+1, e.Path)
+		if e.Title != "" {
+			fmt.Fprintf(w, "Title%d=%s\n", i+1, e.Title)
+		}
+		fmt.Fprintf(w, "Length%d=%d\n", i+1, playlistSeconds(e.Duration))
+	}
+	fmt.Fprintf(w, "NumberOfEntries=%d\nVersion=2\n", len(entries))
+}
+
+// playlistPath evaluates playlist setting, relative path is relative to baseDir
+func playlistPath(format string, data map[string]string, baseDir string) string {
+	p := EvalFormat(format, data)
+	if !filepath.IsAbs(p) && !strings.HasPrefix(p, "~") && !strings.HasPrefix(p, "$") {
+		p = filepath.Join(baseDir, p)
+	}
+	return expandPath(p)
+}
+
+// writePodcastPlaylist writes playlist of all downloaded files of podcast, which still exist
+func writePodcastPlaylist(podcast *Podcast, title string, history *History) error {
+	entries := []*playlistEntry{}
+	for _, e := range history.Downloaded() {
+		if !fileExists(e.Filename) {
+			continue
+		}
+		entries = append(entries, &playlistEntry{Path: e.Filename, Title: e.ItemTitle, PubDate: e.PubDate, Duration: e.Duration})
+	}
+	data := map[string]string{
+		"Name":        replaceIllegalChars(podcast.Name),
+		"Title":       replaceIllegalChars(title),
+		"CurrentDate": time.Now().Format(podcast.DateFormat),
+	}
+	return writePlaylist(playlistPath(podcast.Playlist, data, podcast.DownloadPath), entries)
+}
+
+// writeNewPlaylist writes playlist of files downloaded by last sync,
+// relative path is relative to baseDir
+func writeNewPlaylist(format, baseDir string, items []*DownloadItem) error {
+	entries := []*playlistEntry{}
+	for _, item := range items {
+		entries = append(entries, &playlistEntry{
+			Path:     item.Path,
+			Title:    item.Title + " - " + item.ItemTitle,
+			PubDate:  item.PubDate,
+			Duration: item.Duration,
+		})
+	}
+	data := map[string]string{
+		"CurrentDate": time.Now().Format("20060102"),
+	}
+	return writePlaylist(playlistPath(format, data, baseDir), entries)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestWritePlaylist(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testplaylist")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	entries := []*playlistEntry{
+		{Path: filepath.Join(tmpDir, "b.mp3"), Title: "Second\nepisode", PubDate: time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Path: "/other/a.mp3", Title: "First", PubDate: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC), Duration: 90 * time.Second},
+	}
+
+	m3uPath := filepath.Join(tmpDir, "list.m3u8")
+	assert.NoError(t, writePlaylist(m3uPath, entries))
+	content, _ := ioutil.ReadFile(m3uPath)
+	assert.Equal(t, "#EXTM3U\n#EXTINF:90,First\n/other/a.mp3\n#EXTINF:-1,Second episode\nb.mp3\n", string(content))
+
+	plsPath := filepath.Join(tmpDir, "list.pls")
+	assert.NoError(t, writePlaylist(plsPath, entries))
+	content, _ = ioutil.ReadFile(plsPath)
+	assert.Equal(t, "[playlist]\nFile1=/other/a.mp3\nTitle1=First\nLength1=90\n"+
+		"File2=b.mp3\nTitle2=Second episode\nLength2=-1\nNumberOfEntries=2\nVersion=2\n", string(content))
+}
+
+func TestWritePodcastPlaylist(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testplaylist")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	history, _ := LoadHistory(filepath.Join(tmpDir, "history.json"))
+	existing := filepath.Join(tmpDir, "Show", "1.mp3")
+	os.MkdirAll(filepath.Dir(existing), 0777)
+	ioutil.WriteFile(existing, []byte("audio"), 0666)
+	history.MarkDownloaded(&DownloadItem{Url: "1", ItemTitle: "One", Duration: 90 * time.Second}, existing)
+	history.MarkDownloaded(&DownloadItem{Url: "2", ItemTitle: "Removed"}, filepath.Join(tmpDir, "Show", "2.mp3"))
+
+	podcast := &Podcast{Name: "show"}
+	podcast.DownloadPath = tmpDir
+	podcast.DateFormat = "20060102"
+	podcast.Playlist = "{{Title}}/{{Name}}.m3u8"
+	assert.NoError(t, writePodcastPlaylist(podcast, "Show", history))
+
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "Show", "show.m3u8"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\n#EXTINF:90,One\n1.mp3\n", string(content))
+}
+
+func TestWriteNewPlaylist(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testplaylist")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	items := []*DownloadItem{{Path: filepath.Join(tmpDir, "Show", "1.mp3"), Title: "Show", ItemTitle: "One"}}
+	assert.NoError(t, writeNewPlaylist("new.m3u8", tmpDir, items))
+
+	content, err := ioutil.ReadFile(filepath.Join(tmpDir, "new.m3u8"))
+	assert.NoError(t, err)
+	assert.Equal(t, "#EXTM3U\n#EXTINF:-1,Show - One\n"+filepath.Join("Show", "1.mp3")+"\n", string(content))
+}
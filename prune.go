@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pruneItem is downloaded file selected for removal by retention policy
+type pruneItem struct {
+	Entry  *HistoryEntry
+	Size   int64  // file size on disk
+	Reason string // keep-count, keep-days or keep-size
+}
+
+// parseSize parses size like 500M or 1.5G, suffixes K, M, G, T are powers of 1024,
+// empty string means no limit
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	multiplier := int64(1)
+	for i, suffix := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(s, suffix) {
+			multiplier = int64(1) << (10 * uint(i+1))
+			s = strings.TrimSuffix(s, suffix)
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size '%s', use e.g. 500M or 2G", s)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// entryDate is date used for retention, publish date if feed has it, download date otherwise
+func entryDate(e *HistoryEntry) time.Time {
+	if e.PubDate.IsZero() {
+		return e.RecordedAt
+	}
+	return e.PubDate
+}
+
+// selectPrune returns files, which are not kept by retention settings.
+// Entries are ordered from newest to oldest, file is kept only if it passes all limits
+func selectPrune(entries []*HistoryEntry, sizes map[*HistoryEntry]int64, settings *PodcastSettings, now time.Time) ([]*pruneItem, error) {
+	maxSize, err := parseSize(settings.KeepSize)
+	if err != nil {
+		return nil, fmt.Errorf("keep-size: %s", err)
+	}
+
+	sorted := append([]*HistoryEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return entryDate(sorted[i]).After(entryDate(sorted[j]))
+	})
+
+	items := []*pruneItem{}
+	var keptSize int64
+	kept := 0
+	for _, e := range sorted {
+		size := sizes[e]
+		reason := ""
+		switch {
+		case settings.KeepCount > 0 && kept >= settings.KeepCount:
+			reason = "keep-count"
+		case settings.KeepDays > 0 && now.Sub(entryDate(e)) > time.Duration(settings.KeepDays)*24*time.Hour:
+			reason = "keep-days"
+		case maxSize > 0 && keptSize+size > maxSize:
+			reason = "keep-size"
+		}
+		if reason != "" {
+			items = append(items, &pruneItem{Entry: e, Size: size, Reason: reason})
+			continue
+		}
+		kept++
+		keptSize += size
+	}
+	return items, nil
+}
+
+// hasRetention returns true if any retention limit is set
+func (s *PodcastSettings) hasRetention() bool {
+	return s.KeepCount > 0 || s.KeepDays > 0 || s.KeepSize != ""
+}
+
+// prunePodcast removes downloaded files of podcast according to retention settings.
+// Only files recorded in history are removed, they stay in history as deleted,
+// so they are not downloaded again. If dryRun is set, nothing is changed
+func prunePodcast(podcast *Podcast, history *History, dryRun bool) ([]*pruneItem, error) {
+	if !podcast.hasRetention() {
+		return nil, nil
+	}
+
+	// files removed by user are not counted
+	entries := []*HistoryEntry{}
+	sizes := map[*HistoryEntry]int64{}
+	for _, e := range history.Downloaded() {
+		info, err := os.Stat(e.Filename)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		entries = append(entries, e)
+		sizes[e] = info.Size()
+	}
+
+	items, err := selectPrune(entries, sizes, &podcast.PodcastSettings, time.Now())
+	if err != nil || dryRun {
+		return items, err
+	}
+
+	removed := items[:0]
+	for _, item := range items {
+		if err := os.Remove(item.Entry.Filename); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove %s: %v", item.Entry.Filename, err)
+			continue
+		}
+		// extras are removed with item
+		for _, extra := range item.Entry.Extras {
+			if err := os.Remove(extra); err != nil && !os.IsNotExist(err) {
+				log.Warnf("Failed to remove %s: %v", extra, err)
+			}
+		}
+		history.MarkDeleted(item.Entry)
+		removeEmptyDir(filepath.Dir(item.Entry.Filename), podcast.DownloadPath)
+		removed = append(removed, item)
+	}
+	if len(removed) > 0 {
+		if err := history.Save(); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// removeEmptyDir removes separate-dir of item if it is empty, download path itself is kept
+func removeEmptyDir(dir, downloadPath string) {
+	rel, err := filepath.Rel(downloadPath, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return
+	}
+	os.Remove(dir) // fails if dir is not empty
+}
+
+// prunePodcasts applies retention settings to podcasts and reports removed files
+func prunePodcasts(podcasts []*Podcast, dryRun bool) error {
+	for _, podcast := range podcasts {
+		history, err := LoadHistory(cfg.HistoryPath(podcast))
+		if err != nil {
+			return err
+		}
+		items, err := prunePodcast(podcast, history, dryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %s", podcast.Name, err)
+		}
+		reportPrune(podcast, items, dryRun)
+	}
+	return nil
+}
+
+// reportPrune prints removed files or emits them to machine readable output
+func reportPrune(podcast *Podcast, items []*pruneItem, dryRun bool) {
+	if !output.IsText() {
+		for _, item := range items {
+			output.Emit(newPruneRecord(podcast, item, dryRun))
+		}
+		return
+	}
+	if len(items) == 0 {
+		return
+	}
+	var total int64
+	for _, item := range items {
+		total += item.Size
+	}
+	action := "removed"
+	if dryRun {
+		action = "would be removed"
+	}
+	log.Printf("%s : %d files %s (%s)", podcast.Name, len(items), action, formatSize(total))
+	for _, item := range items {
+		log.Printf("\t* %s [%s]", item.Entry.Filename, item.Reason)
+	}
+}
+
+// formatSize formats size in bytes like 1.5M
+func formatSize(size int64) string {
+	value := float64(size)
+	for _, suffix := range []string{"B", "K", "M", "G"} {
+		if value < 1024 {
+			return strconv.FormatFloat(value, 'f', 1, 64) + suffix
+		}
+		value /= 1024
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + "T"
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"":     0,
+		"100":  100,
+		"2K":   2048,
+		"500M": 500 << 20,
+		"1.5g": 3 << 29,
+		"1GiB": 1 << 30,
+	} {
+		size, err := parseSize(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, size, s)
+	}
+	_, err := parseSize("big")
+	assert.Error(t, err)
+}
+
+func TestSelectPrune(t *testing.T) {
+	now := time.Date(2016, 7, 15, 0, 0, 0, 0, time.UTC)
+	entries := []*HistoryEntry{}
+	sizes := map[*HistoryEntry]int64{}
+	for i := 0; i < 5; i++ { // published 44, 34, 24, 14 and 4 days ago
+		e := &HistoryEntry{Filename: string(rune('a' + i)), PubDate: time.Date(2016, 6, 1+i*10, 0, 0, 0, 0, time.UTC)}
+		entries = append(entries, e)
+		sizes[e] = 100
+	}
+	names := func(items []*pruneItem) []string {
+		result := []string{}
+		for _, item := range items {
+			result = append(result, item.Entry.Filename+":"+item.Reason)
+		}
+		return result
+	}
+
+	items, err := selectPrune(entries, sizes, &PodcastSettings{}, now)
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+
+	items, _ = selectPrune(entries, sizes, &PodcastSettings{KeepCount: 2}, now)
+	assert.Equal(t, []string{"c:keep-count", "b:keep-count", "a:keep-count"}, names(items))
+
+	items, _ = selectPrune(entries, sizes, &PodcastSettings{KeepDays: 30}, now)
+	assert.Equal(t, []string{"b:keep-days", "a:keep-days"}, names(items))
+
+	items, _ = selectPrune(entries, sizes, &PodcastSettings{KeepSize: "250"}, now)
+	assert.Equal(t, []string{"c:keep-size", "b:keep-size", "a:keep-size"}, names(items))
+
+	items, _ = selectPrune(entries, sizes, &PodcastSettings{KeepCount: 4, KeepDays: 20, KeepSize: "150"}, now)
+	assert.Equal(t, []string{"d:keep-size", "c:keep-days", "b:keep-days", "a:keep-days"}, names(items))
+
+	_, err = selectPrune(entries, sizes, &PodcastSettings{KeepSize: "big"}, now)
+	assert.Error(t, err)
+}
+
+func TestPrunePodcast(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testprune")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	history, _ := LoadHistory(filepath.Join(tmpDir, "history.json"))
+	podcast := &Podcast{Name: "test"}
+	podcast.DownloadPath = tmpDir
+	podcast.KeepCount = 1
+
+	paths := []string{}
+	for i, name := range []string{"old/1.mp3", "new/2.mp3"} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0777)
+		if err := ioutil.WriteFile(path, []byte("audio"), 0666); err != nil {
+			t.Fatal("Failed to write file", err)
+		}
+		item := &DownloadItem{Url: name, PubDate: time.Date(2016, 1, 1+i, 0, 0, 0, 0, time.UTC)}
+		history.MarkDownloaded(item, path)
+		paths = append(paths, path)
+	}
+	// unrelated file is never removed
+	unrelated := filepath.Join(tmpDir, "old", "notes.txt")
+	ioutil.WriteFile(unrelated, []byte("notes"), 0666)
+
+	// dry run does not change anything
+	items, err := prunePodcast(podcast, history, true)
+	assert.NoError(t, err)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, paths[0], items[0].Entry.Filename)
+	}
+	assert.True(t, fileExists(paths[0]))
+	assert.Len(t, history.Downloaded(), 2)
+
+	items, err = prunePodcast(podcast, history, false)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.False(t, fileExists(paths[0]))
+	assert.True(t, fileExists(paths[1]))
+	assert.True(t, fileExists(unrelated))
+
+	// removed item stays known, so it is not downloaded again
+	assert.Len(t, history.Downloaded(), 1)
+	assert.True(t, history.Known("", "old/1.mp3"))
+	saved, _ := LoadHistory(filepath.Join(tmpDir, "history.json"))
+	assert.Equal(t, historyDeleted, saved.Entries[historyKey("", "old/1.mp3")].Status)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cavaliercoder/grab"
+)
+
+// downloadQueue hands out download requests to workers.
+// Items of one podcast are downloaded one by one in order, failed items wait for retry out of order,
+// number of parallel downloads from one host is limited by maxPerHost
+type downloadQueue struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	podcasts   []*podcastQueue
+	hosts      map[string]int // active downloads per host
+	maxPerHost int            // 0 means unlimited
+	stopped    bool           // no more requests are handed out
+}
+
+// podcastQueue is download state of one podcast
+type podcastQueue struct {
+	reqs    *podcastRequests
+	next    int               // index of next request
+	busy    bool              // request of podcast is in progress
+	retries []*downloadStatus // failed requests waiting for retry
+}
+
+func newDownloadQueue(downloadReqs []*podcastRequests, maxPerHost int) *downloadQueue {
+	q := &downloadQueue{
+		hosts:      map[string]int{},
+		maxPerHost: maxPerHost,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	for _, reqs := range downloadReqs {
+		q.podcasts = append(q.podcasts, &podcastQueue{reqs: reqs})
+	}
+	return q
+}
+
+// next blocks until some request can be started, returns nil if all requests were handed out.
+// Failed requests waiting for retry are started first, when their delay is over
+func (q *downloadQueue) next() *downloadStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.stopped {
+			return nil
+		}
+		pending := false
+		now := time.Now()
+		for _, p := range q.podcasts {
+			if len(p.retries) == 0 && p.next >= len(p.reqs.Requests) {
+				continue
+			}
+			pending = true
+			if p.busy {
+				continue
+			}
+			for i, status := range p.retries {
+				if now.Before(status.notBefore) || !q.hostFree(status.Request) {
+					continue
+				}
+				p.retries = append(p.retries[:i], p.retries[i+1:]...)
+				q.start(p, status.Request)
+				return status
+			}
+			if p.next >= len(p.reqs.Requests) {
+				continue
+			}
+			req := p.reqs.Requests[p.next]
+			if !q.hostFree(req) {
+				continue
+			}
+
+			q.start(p, req)
+			p.next++
+			return &downloadStatus{
+				Total:   len(p.reqs.Requests),
+				Current: p.next,
+				Request: req,
+				Podcast: p.reqs.Podcast,
+				Item:    p.reqs.Items[p.next-1],
+				History: p.reqs.History,
+				Retry:   p.reqs.Retry,
+				queue:   p,
+			}
+		}
+		if !pending {
+			return nil
+		}
+		q.cond.Wait()
+	}
+}
+
+func (q *downloadQueue) hostFree(req *grab.Request) bool {
+	return q.maxPerHost <= 0 || q.hosts[req.URL().Host] < q.maxPerHost
+}
+
+func (q *downloadQueue) start(p *podcastQueue, req *grab.Request) {
+	p.busy = true
+	q.hosts[req.URL().Host]++
+}
+
+// stop stops handing out requests, waiting workers get nil
+func (q *downloadQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.stopped = true
+	q.cond.Broadcast()
+}
+
+// pending returns requests, which were not handed out
+func (q *downloadQueue) pending() []*downloadStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	statuses := []*downloadStatus{}
+	for _, p := range q.podcasts {
+		for i := p.next; i < len(p.reqs.Requests); i++ {
+			statuses = append(statuses, &downloadStatus{
+				Total:   len(p.reqs.Requests),
+				Current: i + 1,
+				Request: p.reqs.Requests[i],
+				Podcast: p.reqs.Podcast,
+				Item:    p.reqs.Items[i],
+				History: p.reqs.History,
+				Retry:   p.reqs.Retry,
+				queue:   p,
+			})
+		}
+	}
+	return statuses
+}
+
+// done releases podcast and host of completed request
+func (q *downloadQueue) done(status *downloadStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status.queue.busy = false
+	q.hosts[status.Request.URL().Host]--
+	q.cond.Broadcast()
+}
+
+// retry releases podcast and host of failed request, request is handed out again after status.RetryIn,
+// so other requests are downloaded meanwhile
+func (q *downloadQueue) retry(status *downloadStatus) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	status.notBefore = time.Now().Add(status.RetryIn)
+	status.queue.retries = append(status.queue.retries, status)
+	status.queue.busy = false
+	q.hosts[status.Request.URL().Host]--
+	q.cond.Broadcast()
+
+	// wake up waiting workers, when delay is over
+	time.AfterFunc(status.RetryIn, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.cond.Broadcast()
+	})
+}
+
+// waitingRetries returns and removes requests, which were not retried, because queue was stopped
+func (q *downloadQueue) waitingRetries() []*downloadStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	statuses := []*downloadStatus{}
+	for _, p := range q.podcasts {
+		statuses = append(statuses, p.retries...)
+		p.retries = nil
+	}
+	return statuses
+}
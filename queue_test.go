@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cavaliercoder/grab"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func makeTestRequests(urls ...string) *podcastRequests {
+	reqs := &podcastRequests{}
+	for _, url := range urls {
+		req, _ := grab.NewRequest(url)
+		reqs.Requests = append(reqs.Requests, req)
+		reqs.Items = append(reqs.Items, &DownloadItem{Url: url})
+	}
+	return reqs
+}
+
+func TestDownloadQueue(t *testing.T) {
+	q := newDownloadQueue([]*podcastRequests{
+		makeTestRequests("http://one/1.mp3", "http://one/2.mp3"),
+		makeTestRequests("http://one/3.mp3"),
+		makeTestRequests("http://two/4.mp3"),
+	}, 1)
+
+	// second podcast waits for host, first podcast waits for its item
+	first := q.next()
+	assert.Equal(t, "http://one/1.mp3", first.Item.Url)
+	assert.Equal(t, 1, first.Current)
+	assert.Equal(t, 2, first.Total)
+	second := q.next()
+	assert.Equal(t, "http://two/4.mp3", second.Item.Url)
+
+	q.done(first)
+	third := q.next()
+	assert.Equal(t, "http://one/2.mp3", third.Item.Url, "podcast order is broken")
+	assert.Equal(t, 2, third.Current)
+
+	q.done(second)
+	q.done(third)
+	assert.Equal(t, "http://one/3.mp3", q.next().Item.Url)
+	assert.Nil(t, q.next(), "all requests should be handed out")
+}
+
+func TestDownloadQueueStop(t *testing.T) {
+	q := newDownloadQueue([]*podcastRequests{
+		makeTestRequests("http://one/1.mp3", "http://one/2.mp3"),
+	}, 0)
+
+	first := q.next()
+	waiting := make(chan *downloadStatus)
+	go func() { waiting <- q.next() }()
+
+	q.stop()
+	assert.Nil(t, <-waiting, "waiting worker should get nil")
+	q.done(first)
+	assert.Nil(t, q.next())
+
+	pending := q.pending()
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "http://one/2.mp3", pending[0].Item.Url)
+		assert.Equal(t, 2, pending[0].Current)
+	}
+}
+
+func TestDownloadQueueRetry(t *testing.T) {
+	q := newDownloadQueue([]*podcastRequests{
+		makeTestRequests("http://one/1.mp3", "http://one/2.mp3"),
+		makeTestRequests("http://one/3.mp3"),
+	}, 1)
+
+	// failed request releases host and podcast while waiting for retry
+	first := q.next()
+	first.Attempt = 1
+	first.RetryIn = 50 * time.Millisecond
+	q.retry(first)
+	second := q.next()
+	assert.Equal(t, "http://one/2.mp3", second.Item.Url)
+	q.done(second)
+	third := q.next()
+	assert.Equal(t, "http://one/3.mp3", third.Item.Url)
+	q.done(third)
+
+	started := time.Now()
+	retried := q.next()
+	assert.True(t, first == retried, "failed request should be handed out again")
+	assert.True(t, time.Since(started) >= 40*time.Millisecond, "retry delay is not kept")
+	assert.Equal(t, 1, retried.Attempt)
+
+	// stopped queue does not hand out retries
+	retried.RetryIn = time.Hour
+	q.retry(retried)
+	q.stop()
+	assert.Nil(t, q.next())
+	waiting := q.waitingRetries()
+	if assert.Len(t, waiting, 1) {
+		assert.Equal(t, "http://one/1.mp3", waiting[0].Item.Url)
+	}
+	assert.Empty(t, q.pending())
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// partially downloaded files are stored with this suffix until download is completed
+const partSuffix = ".part"
+
+// partMeta holds server validators of partially downloaded file,
+// it's stored near part file with .meta suffix
+type partMeta struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last-modified,omitempty"`
+}
+
+func readPartMeta(path string) (*partMeta, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	meta := new(partMeta)
+	if err := json.Unmarshal(content, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func writePartMeta(path string, meta *partMeta) error {
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0666)
+}
+
+// preparePartFile checks if partially downloaded file can be resumed with range request.
+// Server is asked by HEAD request only if part file exists. Part file is removed, so download
+// starts over, if validators of part are unknown, server does not advertise 'Accept-Ranges: bytes'
+// or file was changed on server (ETag or Last-Modified differ).
+// Part file is kept if HEAD request fails, ranged request decides then
+func preparePartFile(client *http.Client, partPath, url string) error {
+	metaPath := partPath + ".meta"
+	if !fileExists(partPath) {
+		// validators are saved from download response, see savePartValidators
+		return writePartMeta(metaPath, &partMeta{Url: url})
+	}
+
+	oldMeta, err := readPartMeta(metaPath)
+	if err != nil || oldMeta.Url != url || (oldMeta.ETag == "" && oldMeta.LastModified == "") {
+		log.Debug("resume: validators are unknown, start over: ", url)
+		return startOver(partPath, &partMeta{Url: url})
+	}
+	resp, err := client.Head(url)
+	if err != nil {
+		log.Debug("resume: HEAD failed, part is kept: ", err)
+		return nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Debug("resume: HEAD failed, part is kept: ", resp.Status)
+		return nil
+	}
+
+	meta := &partMeta{
+		Url:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch {
+	case resp.Header.Get("Accept-Ranges") != "bytes":
+		log.Debug("resume: ranges are not accepted, start over: ", url)
+	case validatorChanged(oldMeta.ETag, meta.ETag) || validatorChanged(oldMeta.LastModified, meta.LastModified):
+		log.Debug("resume: file was changed on server, start over: ", url)
+	default:
+		return nil
+	}
+	return startOver(partPath, meta)
+}
+
+// validatorChanged returns true if both validators are known and differ
+func validatorChanged(old, new string) bool {
+	return old != "" && new != "" && old != new
+}
+
+// startOver removes part file and saves validators for next download
+func startOver(partPath string, meta *partMeta) error {
+	if err := os.Remove(partPath); err != nil {
+		return err
+	}
+	return writePartMeta(partPath+".meta", meta)
+}
+
+// savePartValidators saves validators of download response as soon as it is received,
+// so resume of interrupted download can check them
+func savePartValidators(partPath, url string, resp *http.Response) error {
+	if resp.StatusCode >= 300 {
+		return nil
+	}
+	meta := &partMeta{Url: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	return writePartMeta(partPath+".meta", meta)
+}
+
+// finishPartFile moves completed download to its final path
+func finishPartFile(partPath, filePath string) error {
+	if err := os.Rename(partPath, filePath); err != nil {
+		return err
+	}
+	os.Remove(partPath + ".meta")
+	return nil
+}
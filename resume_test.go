@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestPreparePartFile(t *testing.T) {
+	etag := `"v1"`
+	ranges := "bytes"
+	headStatus := http.StatusOK
+	heads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		heads++
+		w.Header().Set("ETag", etag)
+		if ranges != "" {
+			w.Header().Set("Accept-Ranges", ranges)
+		}
+		w.WriteHeader(headStatus)
+	}))
+	defer ts.Close()
+
+	tmpDir, err := ioutil.TempDir("", "testresume")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	partPath := filepath.Join(tmpDir, "media.mp3"+partSuffix)
+	writePart := func() {
+		if err := ioutil.WriteFile(partPath, []byte("partial"), 0666); err != nil {
+			t.Fatal("Failed to write part file", err)
+		}
+	}
+
+	// first attempt, server is not asked
+	if err = preparePartFile(http.DefaultClient, partPath, ts.URL); err != nil {
+		t.Fatal("Failed to prepare part file", err)
+	}
+	assert.Equal(t, 0, heads, "HEAD should not be sent without part file")
+
+	// process was killed during transfer, part without validators is not resumed
+	writePart()
+	preparePartFile(http.DefaultClient, partPath, ts.URL)
+	assert.False(t, fileExists(partPath), "part file without validators should start over")
+
+	// validators of download response are saved when transfer starts
+	writePart()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Etag": {etag}}}
+	assert.NoError(t, savePartValidators(partPath, ts.URL, resp))
+
+	// same file on server, part is kept
+	preparePartFile(http.DefaultClient, partPath, ts.URL)
+	assert.True(t, fileExists(partPath), "part file should be resumed")
+
+	// server rejects HEAD, ranged request decides
+	headStatus = http.StatusMethodNotAllowed
+	preparePartFile(http.DefaultClient, partPath, ts.URL)
+	assert.True(t, fileExists(partPath), "part file should be kept if HEAD fails")
+	headStatus = http.StatusOK
+
+	// server does not advertise ranges
+	ranges = ""
+	preparePartFile(http.DefaultClient, partPath, ts.URL)
+	assert.False(t, fileExists(partPath), "part file cannot be resumed without ranges")
+
+	// file was changed on server
+	writePart()
+	ranges = "bytes"
+	etag = `"v2"`
+	preparePartFile(http.DefaultClient, partPath, ts.URL)
+	assert.False(t, fileExists(partPath), "changed file should start over")
+
+	// completed download is moved to final path
+	writePart()
+	filePath := filepath.Join(tmpDir, "media.mp3")
+	if err = finishPartFile(partPath, filePath); err != nil {
+		t.Fatal("Failed to finish part file", err)
+	}
+	assert.True(t, fileExists(filePath), "file was not moved")
+	assert.False(t, fileExists(partPath+".meta"), "meta file was not removed")
+}
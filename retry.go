@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cavaliercoder/grab"
+)
+
+// retryPolicy - how failed downloads are retried
+type retryPolicy struct {
+	Count      int           // retries after first attempt
+	Backoff    time.Duration // delay before first retry, doubled for each next one
+	MaxBackoff time.Duration // delay limit
+}
+
+// delay returns time to wait before next attempt, attempt starts from 1
+func (p retryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
+// canRetry returns true if failed download should be retried after attempt
+func (p retryPolicy) canRetry(attempt int, resp *grab.Response) bool {
+	return attempt <= p.Count && isTransientError(resp)
+}
+
+// finalError is error of step after transfer, e.g. of on-download hook, it is never retried
+type finalError struct {
+	error
+}
+
+// isTransientError returns true if download failed by
+// timeout, server error (5xx) or broken connection, client errors (4xx) are final
+func isTransientError(resp *grab.Response) bool {
+	if _, ok := resp.Error.(*finalError); ok {
+		return false
+	}
+	if resp.HTTPResponse != nil && resp.HTTPResponse.StatusCode >= 400 {
+		return resp.HTTPResponse.StatusCode >= 500
+	}
+	return isTransientNetError(resp.Error)
+}
+
+func isTransientNetError(err error) bool {
+	for err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return true
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return true
+		}
+		switch e := err.(type) {
+		case *url.Error:
+			err = e.Err
+		case *net.OpError:
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case syscall.Errno:
+			return e == syscall.ECONNRESET || e == syscall.ECONNREFUSED ||
+				e == syscall.ECONNABORTED || e == syscall.EPIPE || e == syscall.ETIMEDOUT
+		default:
+			// errors are often formatted by libraries, so check text too
+			msg := err.Error()
+			return strings.Contains(msg, "connection reset") ||
+				strings.Contains(msg, "timeout") ||
+				strings.Contains(msg, "unexpected EOF")
+		}
+	}
+	return false
+}
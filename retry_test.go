@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cavaliercoder/grab"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	p := retryPolicy{Count: 5, Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, p.delay(1))
+	assert.Equal(t, 2*time.Second, p.delay(2))
+	assert.Equal(t, 4*time.Second, p.delay(3))
+	assert.Equal(t, 5*time.Second, p.delay(4))
+	assert.Equal(t, 5*time.Second, p.delay(50))
+}
+
+func TestTransientError(t *testing.T) {
+	statusResp := func(code int) *grab.Response {
+		return &grab.Response{
+			HTTPResponse: &http.Response{StatusCode: code},
+			Error:        errors.New("bad status"),
+		}
+	}
+	assert.True(t, isTransientError(statusResp(503)), "5xx should be retried")
+	assert.False(t, isTransientError(statusResp(429)), "429 should not be retried")
+	assert.False(t, isTransientError(statusResp(404)), "4xx should not be retried")
+
+	reset := &url.Error{Op: "Get", URL: "http://localhost", Err: syscall.ECONNRESET}
+	assert.True(t, isTransientError(&grab.Response{Error: reset}), "connection reset should be retried")
+	assert.False(t, isTransientError(&grab.Response{Error: errors.New("no space left on device")}))
+
+	hookErr := &finalError{errors.New("hook 'timeout 600 ffmpeg' failed: exit status 1")}
+	assert.False(t, isTransientError(&grab.Response{HTTPResponse: &http.Response{StatusCode: 200}, Error: hookErr}),
+		"hook error should not be retried")
+
+	p := retryPolicy{Count: 1}
+	assert.True(t, p.canRetry(1, statusResp(500)))
+	assert.False(t, p.canRetry(2, statusResp(500)), "retry count is exceeded")
+}
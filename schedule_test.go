@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	last := time.Date(2016, 8, 11, 14, 21, 57, 0, time.UTC) // thursday
+
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"6h", last.Add(6 * time.Hour)},
+		{"*/15 * * * *", time.Date(2016, 8, 11, 14, 30, 0, 0, time.UTC)},
+		{"0 6,18 * * *", time.Date(2016, 8, 11, 18, 0, 0, 0, time.UTC)},
+		{"30 2 * * 0", time.Date(2016, 8, 14, 2, 30, 0, 0, time.UTC)},
+		{"30 2 * * 7", time.Date(2016, 8, 14, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 1-3 *", time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2016, 8, 12, 0, 0, 0, 0, time.UTC)}, // day of month or friday
+	}
+	for _, c := range cases {
+		sched, err := parseSchedule(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		assert.Equal(t, c.next, sched.next(last), c.expr)
+	}
+
+	for _, expr := range []string{"", "10s", "daily", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "0 0 31 2 *"} {
+		_, err := parseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
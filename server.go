@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// original feeds are refreshed after this time
+const serverChannelTTL = time.Hour
+
+// timeouts of http server, write timeout is long enough to send large files to slow clients
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverWriteTimeout      = 2 * time.Hour
+)
+
+// server serves downloaded files, local feeds, OPML and html index, access is read-only
+type server struct {
+	user     string // basic auth is enabled if user is set
+	password string
+
+	mu       sync.Mutex
+	channels map[string]*serverChannel // original channels by podcast name
+}
+
+type serverChannel struct {
+	channel   *FeedChannel // nil if feed could not be downloaded
+	fetchedAt time.Time
+}
+
+func newServer(settings *GlobalSettings) *server {
+	return &server{
+		user:     settings.ServeUser,
+		password: settings.ServePassword,
+		channels: map[string]*serverChannel{},
+	}
+}
+
+// podcastID is podcast name used in urls
+func podcastID(podcast *Podcast) string {
+	return sanitizeFileName(podcast.Name)
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+progName+`"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/":
+		s.serveIndex(w, r)
+	case r.URL.Path == "/subscriptions.opml":
+		s.serveOPML(w, r)
+	case strings.HasPrefix(r.URL.Path, "/podcasts/"):
+		s.servePodcast(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *server) authorized(r *http.Request) bool {
+	if s.user == "" {
+		return true
+	}
+	user, password, ok := r.BasicAuth()
+	return ok &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+}
+
+var serverIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+{{range .Podcasts}}<li>{{.Name}} - <a href="{{.Feed}}">feed</a>, <a href="{{.Files}}">files</a>, <a href="{{.Url}}">original feed</a></li>
+{{end}}</ul>
+<p><a href="/subscriptions.opml">OPML of subscriptions</a></p>
+</body>
+</html>
+`))
+
+func (s *server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	type indexPodcast struct {
+		Name, Url, Feed, Files string
+	}
+	data := struct {
+		Title    string
+		Podcasts []indexPodcast
+	}{Title: progName}
+	for _, podcast := range cfg.GetAllPodcasts() {
+		prefix := "/podcasts/" + url.PathEscape(podcastID(podcast))
+		data.Podcasts = append(data.Podcasts, indexPodcast{
+			Name:  podcast.Name,
+			Url:   podcast.Url,
+			Feed:  prefix + "/feed.xml",
+			Files: prefix + "/files/",
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := serverIndexTemplate.Execute(w, data); err != nil {
+		log.Warnf("serve: %v", err)
+	}
+}
+
+func (s *server) serveOPML(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	if err := writeOPML(w, cfg); err != nil {
+		log.Warnf("serve: %v", err)
+	}
+}
+
+// servePodcast serves /podcasts/<id>/feed.xml and /podcasts/<id>/files/...
+func (s *server) servePodcast(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/podcasts/"), "/", 2)
+	var podcast *Podcast
+	for _, p := range cfg.GetAllPodcasts() {
+		if podcastID(p) == parts[0] {
+			podcast = p
+		}
+	}
+	if podcast == nil || len(parts) < 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	prefix := "/podcasts/" + url.PathEscape(parts[0])
+	switch {
+	case parts[1] == "feed.xml":
+		s.serveFeed(w, r, podcast, prefix)
+	case strings.HasPrefix(parts[1], "files/"):
+		history, err := LoadHistory(cfg.HistoryPath(podcast))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		files := http.FileServer(newDownloadDir(podcast.DownloadPath, history))
+		http.StripPrefix("/podcasts/"+parts[0]+"/files", files).ServeHTTP(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// downloadDir is file system of download path, only files recorded in history as downloaded
+// can be opened, so other files of download path and dirs are not served
+type downloadDir struct {
+	http.FileSystem
+	files map[string]bool // slash separated paths relative to download path with leading '/'
+}
+
+func newDownloadDir(downloadPath string, history *History) downloadDir {
+	files := map[string]bool{}
+	for _, e := range history.Downloaded() {
+		for _, p := range append([]string{e.Filename}, e.Extras...) {
+			if rel, err := filepath.Rel(downloadPath, p); err == nil && !strings.HasPrefix(rel, "..") {
+				files["/"+filepath.ToSlash(rel)] = true
+			}
+		}
+	}
+	return downloadDir{FileSystem: http.Dir(downloadPath), files: files}
+}
+
+func (d downloadDir) Open(name string) (http.File, error) {
+	if !d.files[path.Clean("/"+name)] {
+		return nil, os.ErrNotExist
+	}
+	return d.FileSystem.Open(name)
+}
+
+// serveFeed serves feed of downloaded files, enclosures point to this server
+// unless public-base-url is set
+func (s *server) serveFeed(w http.ResponseWriter, r *http.Request, podcast *Podcast, prefix string) {
+	history, err := LoadHistory(cfg.HistoryPath(podcast))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if podcast.PublicBaseUrl == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		podcast.PublicBaseUrl = scheme + "://" + r.Host + prefix + "/files"
+	}
+	channel, err := buildLocalFeed(podcast, s.channel(podcast), history)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content, err := xml.MarshalIndent(&localFeed{Version: "2.0", Channel: channel}, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	w.Write(content)
+}
+
+// channel returns original channel of podcast, it is downloaded again after serverChannelTTL
+func (s *server) channel(podcast *Podcast) *FeedChannel {
+	s.mu.Lock()
+	cached, ok := s.channels[podcast.Name]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < serverChannelTTL {
+		return cached.channel
+	}
+
+	channel, _, err := getFeed(podcast, false)
+	if err != nil {
+		log.Warnf("serve: %s: failed to get feed: %v", podcast.Name, err)
+	}
+	cached = &serverChannel{channel: channel, fetchedAt: time.Now()}
+	s.mu.Lock()
+	s.channels[podcast.Name] = cached
+	s.mu.Unlock()
+	return cached.channel
+}
+
+// serve starts http server, it returns only on error
+func serve(settings *GlobalSettings) error {
+	if settings.ServeUser == "" {
+		log.Warn("Basic auth is disabled, set serve-user and serve-password to enable it")
+	}
+	log.Infof("Serving on http://%s/", settings.ListenAddress)
+	srv := &http.Server{
+		Addr:              settings.ListenAddress,
+		Handler:           newServer(settings),
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		WriteTimeout:      serverWriteTimeout,
+	}
+	return srv.ListenAndServe()
+}
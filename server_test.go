@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestServer(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "testserver")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	defer os.RemoveAll(tmpDir) // clean up
+
+	origin := httptest.NewServer(http.NotFoundHandler())
+	defer origin.Close()
+
+	content := "download-path = " + tmpDir + "\ncache-path = " + tmpDir + "\n\n[my show]\nurl = " + origin.URL + "\n"
+	cfgPath := filepath.Join(tmpDir, "config.ini")
+	ioutil.WriteFile(cfgPath, []byte(content), 0666)
+	savedCfg := cfg
+	defer func() { cfg = savedCfg }()
+	if cfg, err = NewConfig(cfgPath); err != nil {
+		t.Fatal("Failed to read config", err)
+	}
+	podcast, _ := cfg.GetPodcastByName("my show")
+
+	filePath := filepath.Join(tmpDir, "episode.mp3")
+	ioutil.WriteFile(filePath, []byte("0123456789"), 0666)
+	ioutil.WriteFile(filePath+partSuffix, []byte("01"), 0666)
+	ioutil.WriteFile(filePath+partSuffix+".meta", []byte("{}"), 0666)
+	history, _ := LoadHistory(cfg.HistoryPath(podcast))
+	history.MarkDownloaded(&DownloadItem{Url: "http://orig/episode.mp3", ItemTitle: "Episode"}, filePath)
+	history.Save()
+
+	ts := httptest.NewServer(newServer(&GlobalSettings{ServeUser: "user", ServePassword: "secret"}))
+	defer ts.Close()
+
+	get := func(method, path string, header map[string]string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, ts.URL+path, nil)
+		req.SetBasicAuth("user", "secret")
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	// auth is required
+	resp, err := http.Get(ts.URL + "/")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// read-only
+	resp, _ = get("PUT", "/podcasts/my%20show/files/episode.mp3", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, body := get("GET", "/", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `href="/podcasts/my%20show/feed.xml"`)
+
+	resp, body = get("GET", "/subscriptions.opml", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, origin.URL)
+
+	resp, body = get("GET", "/podcasts/my%20show/feed.xml", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `url="`+ts.URL+`/podcasts/my%20show/files/episode.mp3"`)
+
+	// byte ranges are supported
+	resp, body = get("GET", "/podcasts/my%20show/files/episode.mp3", map[string]string{"Range": "bytes=2-4"})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "234", body)
+
+	// incomplete files and their meta files are hidden
+	resp, _ = get("GET", "/podcasts/my%20show/files/episode.mp3"+partSuffix, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get("GET", "/podcasts/my%20show/files/episode.mp3"+partSuffix+".meta", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// only downloaded files are served, config, history and dirs are not
+	ioutil.WriteFile(filepath.Join(tmpDir, ".gopoddl_conf.ini"), []byte("serve-password = secret"), 0666)
+	for _, name := range []string{"", ".gopoddl_conf.ini", "config.ini", "my show.json", "%2E%2E/"} {
+		resp, _ = get("GET", "/podcasts/my%20show/files/"+name, nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, name)
+	}
+	resp, _ = get("GET", "/podcasts/Other/feed.xml", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
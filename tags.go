@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// tag fields and their default formats, tokens are the same as for separate-dir
+var defaultTagFormats = map[string]string{
+	"artist":  "{{Title}}",
+	"album":   "{{Title}}",
+	"title":   "{{ItemTitle}}",
+	"date":    "{{ItemPubDate}}",
+	"comment": "{{ItemDescription}}",
+	"genre":   "Podcast",
+	"track":   "{{ItemIndex}}",
+}
+
+// mediaTags are tag values written to downloaded file
+type mediaTags struct {
+	Artist  string
+	Album   string
+	Title   string
+	Date    string // 2006-01-02 or as is, if it cannot be parsed
+	Comment string
+	Genre   string
+	Track   int
+}
+
+// parseTagsSetting parses 'tags' setting, returns nil if tagging is disabled.
+// Setting is 'true' for default formats or comma separated list of field=format,
+// listed fields override defaults, empty format disables field
+func parseTagsSetting(setting string) (map[string]string, error) {
+	setting = strings.TrimSpace(setting)
+	switch strings.ToLower(setting) {
+	case "", "false", "no", "off":
+		return nil, nil
+	case "true", "yes", "on", "default":
+		return defaultTagFormats, nil
+	}
+
+	formats := map[string]string{}
+	for k, v := range defaultTagFormats {
+		formats[k] = v
+	}
+	for _, pair := range strings.Split(setting, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		field := strings.ToLower(strings.TrimSpace(kv[0]))
+		if _, ok := defaultTagFormats[field]; !ok || len(kv) != 2 {
+			return nil, fmt.Errorf("tags: invalid field '%s', use field=format", strings.TrimSpace(pair))
+		}
+		if format := strings.TrimSpace(kv[1]); format != "" {
+			formats[field] = format
+		} else {
+			delete(formats, field)
+		}
+	}
+	return formats, nil
+}
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// stripHTML removes html tags from podcast description
+func stripHTML(s string) string {
+	return strings.TrimSpace(html.UnescapeString(htmlTagRe.ReplaceAllString(s, "")))
+}
+
+// buildMediaTags evaluates tag formats with item tokens
+func buildMediaTags(formats map[string]string, tokens map[string]string) *mediaTags {
+	eval := func(field string) string {
+		if format, ok := formats[field]; ok {
+			return strings.TrimSpace(EvalFormat(format, tokens))
+		}
+		return ""
+	}
+	tags := &mediaTags{
+		Artist:  eval("artist"),
+		Album:   eval("album"),
+		Title:   eval("title"),
+		Date:    eval("date"),
+		Comment: stripHTML(eval("comment")),
+		Genre:   eval("genre"),
+	}
+	if d, err := parseTime(tags.Date); err == nil && !d.IsZero() {
+		tags.Date = d.Format("2006-01-02")
+	}
+	tags.Track, _ = strconv.Atoi(eval("track"))
+	return tags
+}
+
+// writeItemTags writes tags to downloaded item file according to 'tags' setting
+func writeItemTags(item *DownloadItem, setting string) error {
+	formats, err := parseTagsSetting(setting)
+	if err != nil || formats == nil {
+		return err
+	}
+	return writeMediaTags(item.Path, buildMediaTags(formats, item.Tokens))
+}
+
+// writeMediaTags writes ID3v2 tag to mp3 files or metadata atoms to mp4 files
+func writeMediaTags(path string, tags *mediaTags) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	head := make([]byte, 12)
+	n, _ := io.ReadFull(f, head)
+	f.Close()
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return writeID3Tags(path, tags)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return writeMP4Tags(path, tags)
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0: // mpeg frame sync
+		return writeID3Tags(path, tags)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		return writeID3Tags(path, tags)
+	case ".m4a", ".m4b", ".mp4", ".m4v":
+		return writeMP4Tags(path, tags)
+	}
+	return errors.New("tags: unsupported file format: " + path)
+}
+
+// replaceFileRange replaces bytes from start to end of file with replacement,
+// file is written to temporary file first, then original file is replaced with it
+func replaceFileRange(path string, start, end int64, replacement []byte) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".tagtmp"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := copyReplaced(dst, src, start, end, replacement); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	src.Close()
+	return os.Rename(tmpPath, path)
+}
+
+func copyReplaced(dst io.Writer, src io.ReadSeeker, start, end int64, replacement []byte) error {
+	if _, err := io.CopyN(dst, src, start); err != nil {
+		return err
+	}
+	if _, err := dst.Write(replacement); err != nil {
+		return err
+	}
+	if _, err := src.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(dst, src)
+	return err
+}
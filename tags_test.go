@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestParseTagsSetting(t *testing.T) {
+	formats, err := parseTagsSetting("")
+	assert.NoError(t, err)
+	assert.Nil(t, formats)
+
+	formats, err = parseTagsSetting("true")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultTagFormats, formats)
+
+	formats, err = parseTagsSetting("title={{ItemIndex}}. {{ItemTitle}}, comment=")
+	assert.NoError(t, err)
+	assert.Equal(t, "{{ItemIndex}}. {{ItemTitle}}", formats["title"])
+	assert.Equal(t, "{{Title}}", formats["artist"])
+	_, ok := formats["comment"]
+	assert.False(t, ok)
+	assert.Equal(t, "{{ItemTitle}}", defaultTagFormats["title"], "defaults must not be changed")
+
+	_, err = parseTagsSetting("composer={{Title}}")
+	assert.Error(t, err)
+}
+
+func TestBuildMediaTags(t *testing.T) {
+	tokens := map[string]string{
+		"Title":           "Podcast",
+		"ItemTitle":       "Episode",
+		"ItemPubDate":     "20160102",
+		"ItemIndex":       "7",
+		"ItemDescription": "<p>Tom &amp; Jerry</p>",
+	}
+	tags := buildMediaTags(defaultTagFormats, tokens)
+	assert.Equal(t, &mediaTags{
+		Artist:  "Podcast",
+		Album:   "Podcast",
+		Title:   "Episode",
+		Date:    "2016-01-02",
+		Comment: "Tom & Jerry",
+		Genre:   "Podcast",
+		Track:   7,
+	}, tags)
+}
+
+func tempMediaFile(t *testing.T, name string, content []byte) (string, func()) {
+	tmpDir, err := ioutil.TempDir("", "testtags")
+	if err != nil {
+		t.Fatal("Failed to create tmp dir", err)
+	}
+	path := filepath.Join(tmpDir, name)
+	if err := ioutil.WriteFile(path, content, 0666); err != nil {
+		t.Fatal("Failed to write media file", err)
+	}
+	return path, func() { os.RemoveAll(tmpDir) }
+}
+
+func TestWriteID3Tags(t *testing.T) {
+	audio := []byte{0xFF, 0xFB, 0x90, 0x00, 1, 2, 3}
+	path, cleanup := tempMediaFile(t, "episode.mp3", audio)
+	defer cleanup()
+
+	tags := &mediaTags{Artist: "Artist", Title: "Ünïcode", Date: "2016-01-02", Comment: "Comment", Track: 3}
+	assert.NoError(t, writeMediaTags(path, tags))
+	// second write replaces frames
+	tags.Title = "Title"
+	assert.NoError(t, writeMediaTags(path, tags))
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, frames, tagLen, err := readID3Tag(f)
+	f.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(4), version)
+
+	values := map[string]string{}
+	for _, frame := range frames {
+		values[frame.id] = string(frame.data[1:])
+	}
+	assert.Len(t, frames, 5)
+	assert.Equal(t, "Title", values["TIT2"])
+	assert.Equal(t, "Artist", values["TPE1"])
+	assert.Equal(t, "2016-01-02", values["TDRC"])
+	assert.Equal(t, "3", values["TRCK"])
+	assert.Equal(t, "eng\x00Comment", values["COMM"])
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, audio, content[tagLen:], "audio data must be kept")
+}
+
+func TestWriteID3TagsKeepsVersion(t *testing.T) {
+	// v2.3 tag with one custom frame
+	frame := append([]byte{'T', 'X', 'X', 'X', 0, 0, 0, 3, 0, 0}, 0, 'a', 0)
+	header := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frame))}
+	path, cleanup := tempMediaFile(t, "episode.mp3", append(append(header, frame...), 0xFF, 0xFB))
+	defer cleanup()
+
+	assert.NoError(t, writeID3Tags(path, &mediaTags{Title: "T", Date: "2016-01-02"}))
+
+	f, _ := os.Open(path)
+	version, frames, _, err := readID3Tag(f)
+	f.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(3), version)
+	ids := []string{}
+	for _, frame := range frames {
+		ids = append(ids, frame.id)
+	}
+	assert.Equal(t, []string{"TIT2", "TYER", "TXXX"}, ids)
+	assert.Equal(t, []byte{0x01, 0xFF, 0xFE, 'T', 0}, frames[0].data)
+}
+
+func TestWriteMP4Tags(t *testing.T) {
+	// ftyp, moov with chunk offset pointing into mdat
+	ftyp := makeMP4Atom("ftyp", []byte("M4A \x00\x00\x00\x00"))
+	stco := make([]byte, 12)
+	binary.BigEndian.PutUint32(stco[4:8], 1)
+	makeMoov := func(offset uint32) []byte {
+		binary.BigEndian.PutUint32(stco[8:12], offset)
+		stbl := makeMP4Atom("stbl", makeMP4Atom("stco", stco))
+		trak := makeMP4Atom("trak", makeMP4Atom("mdia", makeMP4Atom("minf", stbl)))
+		return makeMP4Atom("moov", trak)
+	}
+	moov := makeMoov(0)
+	mdatOffset := len(ftyp) + len(moov)
+	moov = makeMoov(uint32(mdatOffset + 8))
+	mdat := makeMP4Atom("mdat", []byte("media"))
+
+	path, cleanup := tempMediaFile(t, "episode.m4a", bytes.Join([][]byte{ftyp, moov, mdat}, nil))
+	defer cleanup()
+
+	assert.NoError(t, writeMediaTags(path, &mediaTags{Title: "Title", Artist: "Artist", Track: 2}))
+	assert.NoError(t, writeMediaTags(path, &mediaTags{Title: "New"}))
+
+	content, _ := ioutil.ReadFile(path)
+	f, _ := os.Open(path)
+	atoms, err := readMP4Atoms(f)
+	f.Close()
+	assert.NoError(t, err)
+	if !assert.Len(t, atoms, 3) {
+		return
+	}
+	newMoov := content[atoms[1].offset+8 : atoms[1].offset+atoms[1].size]
+
+	// chunk offset points to media data again
+	trak, _ := findMP4Child(newMoov, "trak")
+	mdia, _ := findMP4Child(trak, "mdia")
+	minf, _ := findMP4Child(mdia, "minf")
+	stbl, _ := findMP4Child(minf, "stbl")
+	newStco, _ := findMP4Child(stbl, "stco")
+	offset := binary.BigEndian.Uint32(newStco[8:12])
+	assert.Equal(t, "media", string(content[offset:offset+5]))
+
+	udta, _ := findMP4Child(newMoov, "udta")
+	meta, _ := findMP4Child(udta, "meta")
+	ilst, _ := findMP4Child(meta[4:], "ilst")
+	value := func(typ string) string {
+		item, _ := findMP4Child(ilst, typ)
+		data, _ := findMP4Child(item, "data")
+		if len(data) < 8 {
+			return ""
+		}
+		return string(data[8:])
+	}
+	assert.Equal(t, "New", value("\xa9nam"))
+	assert.Equal(t, "Artist", value("\xa9ART"))
+	assert.Equal(t, "\x00\x00\x00\x02\x00\x00\x00\x00", value("trkn"))
+}
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -42,6 +44,49 @@ func fileExists(filePath string) bool {
 	return true
 }
 
+// replace characters, which are not allowed in file names
+func replaceIllegalChars(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r < 32, strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// clean up file name: replace illegal characters, trim spaces and dots
+func sanitizeFileName(name string) string {
+	return strings.Trim(strings.TrimSpace(replaceIllegalChars(name)), ".")
+}
+
+// uniqueFileName returns name, which is not used in dir by existing file
+// or by other name in used, counter is added to name if needed: name (2).ext
+func uniqueFileName(dir, name string, used map[string]bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for n := 2; ; n++ {
+		fullPath := filepath.Join(dir, candidate)
+		// name is taken only if it exists, e.g. dir which is a file is reported later by MkdirAll
+		if _, err := os.Stat(fullPath); !used[fullPath] && err != nil {
+			used[fullPath] = true
+			return candidate
+		}
+		candidate = base + " (" + strconv.Itoa(n) + ")" + ext
+	}
+}
+
+// sortedKeys returns map keys in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func parseTime(formatted string) (time.Time, error) {
 	var layouts = [...]string{
 		"20060102",
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-ini/ini"
+)
+
+// ValidationError is problem of config setting
+type ValidationError struct {
+	Podcast string `json:"podcast,omitempty"` // empty for default section
+	Setting string `json:"setting,omitempty"`
+	Column  int    `json:"column,omitempty"` // column in setting value starting from 1, 0 if unknown
+	Msg     string `json:"error"`
+}
+
+func (e *ValidationError) Error() string {
+	section := e.Podcast
+	if section == "" {
+		section = ini.DEFAULT_SECTION
+	}
+	s := "[" + section + "]"
+	if e.Setting != "" {
+		s += " " + e.Setting
+	}
+	if e.Column > 0 {
+		s += fmt.Sprintf(", column %d", e.Column)
+	}
+	return s + ": " + e.Msg
+}
+
+// ValidationErrors are all problems found in config
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// add adds error, same errors of settings inherited from default section are added once
+func (errs *ValidationErrors) add(err *ValidationError) {
+	for _, e := range *errs {
+		if *e == *err {
+			return
+		}
+	}
+	*errs = append(*errs, err)
+}
+
+// column returns column of byte position in string
+func column(s string, pos int) int {
+	return utf8.RuneCountInString(s[:pos]) + 1
+}
+
+// checkFilter checks filter syntax and token names, filter is evaluated with empty tokens
+func checkFilter(filter string) *ValidationError {
+	compiled, err := CompileFilter(filter, false)
+	if err == nil {
+		err = compiled.CheckVariables(filterData(&FeedItem{}, &FeedEnclosure{}))
+	}
+	if err == nil {
+		return nil
+	}
+	if ferr, ok := err.(*FilterError); ok && ferr.Pos <= len(filter) {
+		return &ValidationError{Column: column(filter, ferr.Pos), Msg: ferr.Msg}
+	}
+	return &ValidationError{Msg: err.Error()}
+}
+
+var tokenRe = regexp.MustCompile("^{{[A-Za-z]+}}")
+
+// checkTemplate checks that all tokens of template are known
+func checkTemplate(template string, tokens map[string]string) []*ValidationError {
+	errs := []*ValidationError{}
+	for pos := strings.Index(template, "{{"); pos >= 0; {
+		end := pos + 2
+		if loc := tokenRe.FindStringIndex(template[pos:]); loc == nil {
+			errs = append(errs, &ValidationError{Column: column(template, pos), Msg: "malformed token, use {{Name}}"})
+		} else {
+			end = pos + loc[1]
+			if name := template[pos+2 : end-2]; !hasKey(tokens, name) {
+				errs = append(errs, &ValidationError{Column: column(template, pos), Msg: "unknown token {{" + name + "}}"})
+			}
+		}
+		next := strings.Index(template[end:], "{{")
+		if next < 0 {
+			break
+		}
+		pos = end + next
+	}
+	return errs
+}
+
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// checkDownloadPath checks that download path exists and files can be created in it
+func checkDownloadPath(path string) string {
+	if path == "" {
+		return "is not set"
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return "does not exist: " + path
+	} else if err != nil {
+		return err.Error()
+	}
+	if !info.IsDir() {
+		return "is not a directory: " + path
+	}
+	f, err := ioutil.TempFile(path, ".gopoddl-validate")
+	if err != nil {
+		return "is not writable: " + path
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return ""
+}
+
+// templateSettings are settings with tokens, they are checked when config is loaded
+func templateSettings(podcast *Podcast) []*ValidationError {
+	errs := []*ValidationError{}
+	if podcast.Filter != "" {
+		if err := checkFilter(podcast.Filter); err != nil {
+			err.Setting = "filter"
+			errs = append(errs, err)
+		}
+	}
+	formatTokens := (&Filter{}).formatData(&FeedChannel{}, &FeedItem{}, &FeedEnclosure{}, 0)
+	playlistTokens := map[string]string{"Name": "", "Title": "", "CurrentDate": ""}
+	for _, t := range []struct {
+		setting, value string
+		tokens         map[string]string
+	}{
+		{"separate-dir", podcast.SeparateDir, formatTokens},
+		{"file-name", podcast.FileName, formatTokens},
+		{"playlist", podcast.Playlist, playlistTokens},
+	} {
+		for _, err := range checkTemplate(t.value, t.tokens) {
+			err.Setting = t.setting
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// valueSettings checks values of other podcast settings
+func valueSettings(podcast *Podcast) []*ValidationError {
+	errs := []*ValidationError{}
+	check := func(setting string, err error) {
+		if err != nil {
+			errs = append(errs, &ValidationError{Setting: setting, Msg: err.Error()})
+		}
+	}
+	_, err := parseTagsSetting(podcast.Tags)
+	check("tags", err)
+	_, err = parseExtrasSetting(podcast.Extras)
+	check("extras", err)
+	if podcast.KeepSize != "" {
+		_, err = parseSize(podcast.KeepSize)
+		check("keep-size", err)
+	}
+	if podcast.Interval != "" {
+		_, err = parseSchedule(podcast.Interval)
+		check("interval", err)
+	}
+	_, err = parseBandwidth(podcast.MaxBandwidth)
+	check("max-bandwidth", err)
+	_, err = parseBandwidthSchedule(podcast.BandwidthSchedule)
+	check("bandwidth-schedule", err)
+	if msg := checkDownloadPath(podcast.DownloadPath); msg != "" {
+		errs = append(errs, &ValidationError{Setting: "download-path", Msg: msg})
+	}
+	return errs
+}
+
+// isDefaultSection checks section name, name of default section is lower case if config is case insensitive
+func isDefaultSection(name string) bool {
+	return strings.EqualFold(name, ini.DEFAULT_SECTION)
+}
+
+// defaultPodcast returns settings of default section as podcast without name
+func (c *Config) defaultPodcast() (*Podcast, error) {
+	settings := podcastSettingsDefaults()
+	if err := c.cfg.Section(ini.DEFAULT_SECTION).MapTo(settings); err != nil {
+		return nil, err
+	}
+	settings.expandPaths()
+	return &Podcast{PodcastSettings: *settings}, nil
+}
+
+// checkPodcasts checks settings of default section and of all podcasts by check function.
+// Error of setting inherited from default section is reported for default section once
+func (c *Config) checkPodcasts(check func(*Podcast) []*ValidationError) ValidationErrors {
+	errs := ValidationErrors{}
+	defaultPodcast, err := c.defaultPodcast()
+	if err != nil {
+		errs.add(&ValidationError{Msg: err.Error()})
+		return errs
+	}
+	podcasts := []*Podcast{defaultPodcast}
+	for _, name := range c.cfg.SectionStrings() {
+		if isDefaultSection(name) {
+			continue
+		}
+		podcast, err := c.GetPodcastByName(name)
+		if err != nil {
+			errs.add(&ValidationError{Podcast: name, Msg: err.Error()})
+			continue
+		}
+		podcasts = append(podcasts, podcast)
+	}
+
+	for _, podcast := range podcasts {
+		for _, err := range check(podcast) {
+			if podcast.Name != "" && c.cfg.Section(podcast.Name).HasKey(err.Setting) {
+				err.Podcast = podcast.Name
+			}
+			errs.add(err)
+		}
+	}
+	return errs
+}
+
+// checkKeys reports unknown settings and global settings set per podcast
+func (c *Config) checkKeys() ValidationErrors {
+	errs := ValidationErrors{}
+	podcastKeys := podcastSettingKeys()
+	globalKeys := iniKeys(GlobalSettings{})
+	ownKeys := iniKeys(Podcast{})
+	for _, section := range c.cfg.Sections() {
+		name := section.Name()
+		if isDefaultSection(name) {
+			name = ""
+		} else if !section.HasKey("url") {
+			errs.add(&ValidationError{Podcast: name, Setting: "url", Msg: "is not set"})
+		}
+		for _, key := range section.KeyStrings() {
+			switch {
+			case podcastKeys[key]:
+			case name == "" && globalKeys[key]:
+			case name != "" && ownKeys[key]:
+			case name != "" && globalKeys[key]:
+				errs.add(&ValidationError{Podcast: name, Setting: key, Msg: "global setting cannot be set per podcast"})
+			default:
+				errs.add(&ValidationError{Podcast: name, Setting: key, Msg: "unknown setting"})
+			}
+		}
+	}
+	return errs
+}
+
+// Validate checks all settings of config and returns all found problems
+func (c *Config) Validate() ValidationErrors {
+	errs := c.checkKeys()
+	if _, err := c.GetGlobalSettings(); err != nil {
+		errs.add(&ValidationError{Msg: err.Error()})
+	}
+	for _, err := range c.checkPodcasts(templateSettings) {
+		errs.add(err)
+	}
+	for _, err := range c.checkPodcasts(valueSettings) {
+		errs.add(err)
+	}
+	return errs
+}
+
+// reportValidation prints validation errors
+func reportValidation(errs ValidationErrors) {
+	if !output.IsText() {
+		for _, err := range errs {
+			output.Emit(err)
+		}
+		return
+	}
+	if len(errs) == 0 {
+		log.Info("Config is valid")
+		return
+	}
+	for _, err := range errs {
+		log.Warn(err.Error())
+	}
+}
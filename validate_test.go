@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func writeTestConfig(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "config.ini")
+	if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckFilter(t *testing.T) {
+	assert.Nil(t, checkFilter("'x' in {{ItemTitle}} and {{ItemDuration}} > 10m"))
+
+	err := checkFilter("'x' in {{ItemTitel}}")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 10, err.Column)
+		assert.Contains(t, err.Msg, "ItemTitel")
+	}
+	err = checkFilter("'Хрусталев' inn {{ItemTitle}}")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 13, err.Column)
+	}
+}
+
+func TestCheckTemplate(t *testing.T) {
+	tokens := map[string]string{"Name": "", "ItemTitle": ""}
+	assert.Empty(t, checkTemplate("{{Name}}/{{ItemTitle}}", tokens))
+
+	errs := checkTemplate("{{Name}}/{{Season}}/{{Item Title}}", tokens)
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, 10, errs[0].Column)
+		assert.Equal(t, "unknown token {{Season}}", errs[0].Msg)
+		assert.Equal(t, 21, errs[1].Column)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gopoddl")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestConfig(t, dir, `
+download-path = `+dir+`
+separate-dir  = {{Name}}/{{Seasn}}
+max-parallel-downloads = 2
+colour = red
+
+[one]
+url    = http://localhost/one.xml
+filter = 'x' in {{ItemTitel}}
+
+[two]
+url           = http://localhost/two.xml
+download-path = `+filepath.Join(dir, "missing")+`
+serve-user    = me
+keep-size     = 10X
+bandwidth-schedule = 01:00-06:00
+`)
+	_, err = NewConfig(path)
+	if assert.Error(t, err) {
+		errs, ok := err.(ValidationErrors)
+		if assert.True(t, ok) {
+			assert.Len(t, errs, 2)
+		}
+	}
+
+	c, err := loadConfig(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	errs := c.Validate()
+	messages := []string{}
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assert.Equal(t, []string{
+		"[DEFAULT] colour: unknown setting",
+		"[two] serve-user: global setting cannot be set per podcast",
+		"[DEFAULT] separate-dir, column 10: unknown token {{Seasn}}",
+		"[one] filter, column 10: Variable ItemTitel was not found in provided data",
+		"[two] keep-size: invalid size '10X', use e.g. 500M or 2G",
+		"[two] bandwidth-schedule: invalid bandwidth period '01:00-06:00', use e.g. 01:00-06:00=0 or 18:00-23:00=1MB/s",
+		"[two] download-path: does not exist: " + filepath.Join(dir, "missing"),
+	}, messages)
+
+	path = writeTestConfig(t, dir, `
+download-path = `+dir+`
+
+[one]
+url = http://localhost/one.xml
+`)
+	c, err = NewConfig(path)
+	if assert.NoError(t, err) {
+		assert.Empty(t, c.Validate())
+	}
+}